@@ -0,0 +1,98 @@
+// batch.go - Kyber batch encapsulation.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var (
+	// ErrInvalidBatch is the error returned when a batch is empty, or the
+	// recipient index is out of range.
+	ErrInvalidBatch = errors.New("kyber: invalid batch")
+
+	batchTranscriptDomainSep = []byte("Kyber-BatchTranscript")
+	batchSecretDomainSep     = []byte("Kyber-BatchSecret")
+)
+
+// KEMEncryptBatch generates a cipher text and shared secret for each of the
+// public keys, via KEMEncrypt, and binds each shared secret to the entire
+// batch of cipher texts.  The returned shared secrets are:
+//
+//	th = SHAKE-256("Kyber-BatchTranscript" || len(cts) || len(ct_0) || ct_0 || ...)
+//	ss'_i = SHAKE-256("Kyber-BatchSecret" || len(ss_i) || ss_i || len(th) || th)
+//
+// so that a recipient only derives the same shared secret as the sender if
+// it received the same set of cipher texts, in the same order, preventing
+// the substitution of other recipients' cipher texts.  All of the cipher
+// texts MUST be delivered to every recipient.
+func KEMEncryptBatch(publicKeys []*PublicKey, rng io.Reader) (cipherTexts [][]byte, sharedSecrets [][]byte, err error) {
+	if len(publicKeys) == 0 {
+		return nil, nil, ErrInvalidBatch
+	}
+
+	cipherTexts = make([][]byte, 0, len(publicKeys))
+	sharedSecrets = make([][]byte, 0, len(publicKeys))
+	for _, pk := range publicKeys {
+		ct, ss, err := pk.KEMEncrypt(rng)
+		if err != nil {
+			for _, v := range sharedSecrets {
+				zeroize(v)
+			}
+			return nil, nil, err
+		}
+		cipherTexts = append(cipherTexts, ct)
+		sharedSecrets = append(sharedSecrets, ss)
+	}
+
+	th := batchTranscriptHash(cipherTexts)
+	for i, ss := range sharedSecrets {
+		sharedSecrets[i] = expandSecret(batchSecretDomainSep, ss, th, SharedSecretSize)
+		zeroize(ss)
+	}
+
+	return cipherTexts, sharedSecrets, nil
+}
+
+// KEMDecryptBatch generates the shared secret for the index-th cipher text
+// of a batch generated via KEMEncryptBatch, bound to the entire batch of
+// cipher texts.
+func (sk *PrivateKey) KEMDecryptBatch(cipherTexts [][]byte, index int) ([]byte, error) {
+	if index < 0 || index >= len(cipherTexts) {
+		return nil, ErrInvalidBatch
+	}
+	if len(cipherTexts[index]) != sk.PublicKey.p.CipherTextSize() {
+		return nil, ErrInvalidCipherTextSize
+	}
+
+	ss := sk.KEMDecrypt(cipherTexts[index])
+	defer zeroize(ss)
+
+	return expandSecret(batchSecretDomainSep, ss, batchTranscriptHash(cipherTexts), SharedSecretSize), nil
+}
+
+func batchTranscriptHash(cipherTexts [][]byte) []byte {
+	var l [8]byte
+
+	xof := hashImpl.NewShake256()
+	xof.Write(batchTranscriptDomainSep)
+	binary.BigEndian.PutUint64(l[:], uint64(len(cipherTexts)))
+	xof.Write(l[:])
+	for _, ct := range cipherTexts {
+		binary.BigEndian.PutUint64(l[:], uint64(len(ct)))
+		xof.Write(l[:])
+		xof.Write(ct)
+	}
+
+	th := make([]byte, SymSize)
+	xof.Read(th)
+
+	return th
+}
@@ -0,0 +1,75 @@
+// batch_test.go - Kyber batch encapsulation tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKEMBatch(t *testing.T) {
+	require := require.New(t)
+
+	var (
+		pks []*PublicKey
+		sks []*PrivateKey
+	)
+	for _, p := range allParams {
+		pk, sk, err := p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "%s: GenerateKeyPair()", p.Name())
+		pks = append(pks, pk)
+		sks = append(sks, sk)
+	}
+
+	cts, sss, err := KEMEncryptBatch(pks, rand.Reader)
+	require.NoError(err, "KEMEncryptBatch()")
+	require.Len(cts, len(pks), "KEMEncryptBatch(): Cipher texts")
+	require.Len(sss, len(pks), "KEMEncryptBatch(): Shared secrets")
+
+	for i, sk := range sks {
+		n := sk.PublicKey.p.Name()
+		require.Len(sss[i], SharedSecretSize, "%s: KEMEncryptBatch(): Shared secret size", n)
+
+		ss, err := sk.KEMDecryptBatch(cts, i)
+		require.NoError(err, "%s: KEMDecryptBatch()", n)
+		require.Equal(sss[i], ss, "%s: KEMDecryptBatch(): Shared secret", n)
+
+		// The batch secret must differ from the plain KEM secret.
+		require.NotEqual(sk.KEMDecrypt(cts[i]), ss, "%s: KEMDecryptBatch(): Unbound", n)
+	}
+
+	// Substituting another recipient's cipher text must change every
+	// recipient's shared secret.
+	cts2, _, err := KEMEncryptBatch(pks[1:2], rand.Reader)
+	require.NoError(err, "KEMEncryptBatch(): Substitute")
+	subst := append([][]byte{}, cts...)
+	subst[1] = cts2[0]
+	for _, i := range []int{0, 2} {
+		ss, err := sks[i].KEMDecryptBatch(subst, i)
+		require.NoError(err, "KEMDecryptBatch(): Substituted")
+		require.NotEqual(sss[i], ss, "KEMDecryptBatch(): Substituted (%d)", i)
+	}
+
+	// Re-ordering must also change the shared secrets.
+	reordered := [][]byte{cts[0], cts[2], cts[1]}
+	ss, err := sks[0].KEMDecryptBatch(reordered, 0)
+	require.NoError(err, "KEMDecryptBatch(): Reordered")
+	require.NotEqual(sss[0], ss, "KEMDecryptBatch(): Reordered")
+
+	// Invalid batches.
+	_, _, err = KEMEncryptBatch(nil, rand.Reader)
+	require.Equal(ErrInvalidBatch, err, "KEMEncryptBatch(): Empty")
+	_, _, err = KEMEncryptBatch(pks, nil)
+	require.Equal(ErrNilRandomSource, err, "KEMEncryptBatch(): nil rng")
+	_, err = sks[0].KEMDecryptBatch(cts, len(cts))
+	require.Equal(ErrInvalidBatch, err, "KEMDecryptBatch(): Out of range")
+	_, err = sks[0].KEMDecryptBatch(cts, 1)
+	require.Equal(ErrInvalidCipherTextSize, err, "KEMDecryptBatch(): Wrong cipher text")
+}
@@ -0,0 +1,233 @@
+// capsule.go - Kyber cipher text capsules.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"encoding"
+	"errors"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = (*Capsule)(nil)
+	_ encoding.BinaryUnmarshaler = (*Capsule)(nil)
+
+	// ErrUnknownRecipient is the error returned when a Capsule does not
+	// contain a recipient KeyID, or it does not match any of the candidate
+	// private keys.
+	ErrUnknownRecipient = errors.New("kyber: unknown capsule recipient")
+
+	// ErrInvalidCapsule is the error returned when a binary serialized
+	// Capsule has malformed framing (eg: unknown flags).
+	ErrInvalidCapsule = errors.New("kyber: invalid capsule")
+)
+
+const (
+	capsuleFlagSharedSecret = 1 << 0
+	capsuleFlagKeyID        = 1 << 1
+)
+
+// Capsule is a portable bundle of a Kyber cipher text, the ParameterSet it
+// was generated under, and optionally the corresponding shared secret (eg:
+// for the sender to keep alongside the cipher text), and the recipient's
+// KeyID.
+type Capsule struct {
+	p            *ParameterSet
+	cipherText   []byte
+	sharedSecret []byte
+	keyID        *[SymSize]byte
+}
+
+// NewCapsule returns a Capsule containing a cipher text, and an optional
+// (nil) shared secret, for the ParameterSet.
+func (p *ParameterSet) NewCapsule(cipherText, sharedSecret []byte) (*Capsule, error) {
+	if len(cipherText) != p.cipherTextSize {
+		return nil, ErrInvalidCipherTextSize
+	}
+	if sharedSecret != nil && len(sharedSecret) != SharedSecretSize {
+		return nil, ErrInvalidSharedSecretSize
+	}
+
+	c := &Capsule{
+		p:          p,
+		cipherText: append([]byte{}, cipherText...),
+	}
+	if sharedSecret != nil {
+		c.sharedSecret = append([]byte{}, sharedSecret...)
+	}
+
+	return c, nil
+}
+
+// ParameterSet returns the ParameterSet of a Capsule.
+func (c *Capsule) ParameterSet() *ParameterSet {
+	return c.p
+}
+
+// CipherText returns the cipher text contained in a Capsule.
+func (c *Capsule) CipherText() []byte {
+	return append([]byte{}, c.cipherText...)
+}
+
+// SharedSecret returns the shared secret contained in a Capsule, or nil if
+// it does not contain one.
+func (c *Capsule) SharedSecret() []byte {
+	if c.sharedSecret == nil {
+		return nil
+	}
+	return append([]byte{}, c.sharedSecret...)
+}
+
+// SetKeyID sets the recipient KeyID hint of a Capsule to the Fingerprint of
+// the recipient's PublicKey, so that a receiver with many private keys can
+// select the correct one with RouteCipherText, instead of attempting to
+// decapsulate with each of them.
+//
+// WARNING: The KeyID hint reveals the recipient's identity to anyone who can
+// see the Capsule.  It is sent in the clear, and matches the Fingerprint of
+// the recipient's public key, so it SHOULD only be set when the recipient is
+// not meant to be anonymous.
+func (c *Capsule) SetKeyID(pk *PublicKey) error {
+	if c.p != pk.p {
+		return ErrParameterSetMismatch
+	}
+
+	keyID := pk.Fingerprint()
+	c.keyID = &keyID
+
+	return nil
+}
+
+// KeyID returns the recipient KeyID hint of a Capsule, and true, or false if
+// it does not contain one.  The hint reveals the recipient's identity, see
+// SetKeyID.
+func (c *Capsule) KeyID() ([SymSize]byte, bool) {
+	if c.keyID == nil {
+		return [SymSize]byte{}, false
+	}
+	return *c.keyID, true
+}
+
+// RouteCipherText returns the private key that a Capsule is intended for, by
+// looking up its recipient KeyID in keys, which is indexed by each private
+// key's Fingerprint.  ErrUnknownRecipient is returned if the Capsule does
+// not contain a KeyID, or if there is no matching key.  The KeyID hint
+// reveals the recipient's identity to anyone who can see the Capsule.
+func RouteCipherText(c *Capsule, keys map[[SymSize]byte]*PrivateKey) (*PrivateKey, error) {
+	if c.keyID == nil {
+		return nil, ErrUnknownRecipient
+	}
+
+	sk, ok := keys[*c.keyID]
+	if !ok {
+		return nil, ErrUnknownRecipient
+	}
+	if sk.PublicKey.p != c.p {
+		return nil, ErrParameterSetMismatch
+	}
+
+	return sk, nil
+}
+
+// Zeroize wipes the shared secret (if any) contained in a Capsule, and
+// removes it from the Capsule.
+func (c *Capsule) Zeroize() {
+	zeroize(c.sharedSecret)
+	c.sharedSecret = nil
+}
+
+// MarshalBinary returns the self-describing binary serialization of a
+// Capsule, which includes the format version and ParameterSet.
+//
+// WARNING: If the Capsule contains a shared secret, the serialized Capsule
+// MUST be treated as secret.
+func (c *Capsule) MarshalBinary() ([]byte, error) {
+	var flags byte
+	if c.sharedSecret != nil {
+		flags |= capsuleFlagSharedSecret
+	}
+	if c.keyID != nil {
+		flags |= capsuleFlagKeyID
+	}
+
+	b := make([]byte, 0, 1+len(c.cipherText)+SymSize+len(c.sharedSecret))
+	b = append(b, flags)
+	b = append(b, c.cipherText...)
+	if c.keyID != nil {
+		b = append(b, c.keyID[:]...)
+	}
+	b = append(b, c.sharedSecret...)
+
+	return marshalHeader(c.p, b), nil
+}
+
+// UnmarshalBinary deserializes a Capsule serialized via MarshalBinary.
+//
+// A truncated cipher text or shared secret results in
+// ErrInvalidCipherTextSize or ErrInvalidSharedSecretSize respectively, and
+// malformed framing (unknown flags, a truncated KeyID, or trailing data) in
+// ErrInvalidCapsule.
+func (c *Capsule) UnmarshalBinary(data []byte) error {
+	if len(data) < marshalHeaderSize {
+		return ErrInvalidCipherTextSize
+	}
+	p, b, err := unmarshalHeader(data)
+	if err != nil {
+		return err
+	}
+	if len(b) < 1+p.cipherTextSize {
+		return ErrInvalidCipherTextSize
+	}
+
+	flags := b[0]
+	if flags&^(capsuleFlagSharedSecret|capsuleFlagKeyID) != 0 {
+		return ErrInvalidCapsule
+	}
+	cipherText, b := b[1:1+p.cipherTextSize], b[1+p.cipherTextSize:]
+
+	var keyID *[SymSize]byte
+	if flags&capsuleFlagKeyID != 0 {
+		if len(b) < SymSize {
+			return ErrInvalidCapsule
+		}
+		keyID = new([SymSize]byte)
+		copy(keyID[:], b)
+		b = b[SymSize:]
+	}
+
+	var sharedSecret []byte
+	if flags&capsuleFlagSharedSecret != 0 {
+		if len(b) < SharedSecretSize {
+			return ErrInvalidSharedSecretSize
+		}
+		sharedSecret, b = b[:SharedSecretSize], b[SharedSecretSize:]
+	}
+	if len(b) != 0 {
+		return ErrInvalidCapsule
+	}
+
+	k, err := p.NewCapsule(cipherText, sharedSecret)
+	if err != nil {
+		return err
+	}
+	k.keyID = keyID
+	*c = *k
+
+	return nil
+}
+
+// OpenCapsule generates the shared secret for the cipher text contained in a
+// Capsule via the CCA-secure Kyber key encapsulation mechanism, and is
+// otherwise identical to KEMDecrypt.  Any shared secret contained in the
+// Capsule is ignored.
+func (sk *PrivateKey) OpenCapsule(c *Capsule) ([]byte, error) {
+	if c.p != sk.PublicKey.p {
+		return nil, ErrParameterSetMismatch
+	}
+
+	return sk.KEMDecrypt(c.cipherText), nil
+}
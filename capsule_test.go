@@ -0,0 +1,172 @@
+// capsule_test.go - Kyber cipher text capsule tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapsule(t *testing.T) {
+	for _, p := range allParams {
+		t.Run(p.Name(), func(t *testing.T) { doTestCapsule(t, p) })
+	}
+}
+
+func doTestCapsule(t *testing.T, p *ParameterSet) {
+	require := require.New(t)
+
+	pk, sk, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+	ct, ss, err := pk.KEMEncrypt(rand.Reader)
+	require.NoError(err, "KEMEncrypt()")
+
+	for _, withSS := range []bool{true, false} {
+		var capSS []byte
+		if withSS {
+			capSS = ss
+		}
+
+		c, err := p.NewCapsule(ct, capSS)
+		require.NoError(err, "NewCapsule(): %v", withSS)
+		b, err := c.MarshalBinary()
+		require.NoError(err, "MarshalBinary(): %v", withSS)
+
+		var c2 Capsule
+		err = c2.UnmarshalBinary(b)
+		require.NoError(err, "UnmarshalBinary(): %v", withSS)
+		require.Equal(p, c2.ParameterSet(), "UnmarshalBinary(): ParameterSet")
+		require.Equal(ct, c2.CipherText(), "UnmarshalBinary(): CipherText")
+		require.Equal(capSS, c2.SharedSecret(), "UnmarshalBinary(): SharedSecret")
+
+		ss2, err := sk.OpenCapsule(&c2)
+		require.NoError(err, "OpenCapsule(): %v", withSS)
+		require.Equal(ss, ss2, "OpenCapsule(): %v", withSS)
+
+		// Truncated and extended serializations must be rejected.
+		truncErr := ErrInvalidCipherTextSize
+		if withSS {
+			truncErr = ErrInvalidSharedSecretSize
+		}
+		require.Equal(truncErr, c2.UnmarshalBinary(b[:len(b)-1]), "UnmarshalBinary(): Truncated")
+		require.Equal(ErrInvalidCapsule, c2.UnmarshalBinary(append(b, 0)), "UnmarshalBinary(): Trailing data")
+	}
+
+	c, err := p.NewCapsule(ct, ss)
+	require.NoError(err, "NewCapsule()")
+	c.Zeroize()
+	require.Nil(c.SharedSecret(), "Zeroize()")
+
+	_, err = p.NewCapsule(ct[1:], nil)
+	require.Equal(ErrInvalidCipherTextSize, err, "NewCapsule(): Truncated ct")
+	_, err = p.NewCapsule(ct, ss[1:])
+	require.Equal(ErrInvalidSharedSecretSize, err, "NewCapsule(): Truncated ss")
+
+	c, err = p.NewCapsule(ct, ss)
+	require.NoError(err, "NewCapsule()")
+	b, err := c.MarshalBinary()
+	require.NoError(err, "MarshalBinary()")
+	ctEnd := marshalHeaderSize + 1 + p.CipherTextSize()
+	for _, v := range []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{"Short header", b[:marshalHeaderSize-1], ErrInvalidCipherTextSize},
+		{"Invalid version", append([]byte{marshalVersion + 1}, b[1:]...), ErrUnsupportedVersion},
+		{"Invalid ParameterSet", append([]byte{b[0], 0xff}, b[2:]...), ErrInvalidParameterSet},
+		{"No flags", b[:marshalHeaderSize], ErrInvalidCipherTextSize},
+		{"Truncated ct", b[:ctEnd-1], ErrInvalidCipherTextSize},
+		{"Invalid flag", append(append(append([]byte{}, b[:marshalHeaderSize]...), 4), b[marshalHeaderSize+1:]...), ErrInvalidCapsule},
+		{"Truncated ss", b[:len(b)-1], ErrInvalidSharedSecretSize},
+	} {
+		var c2 Capsule
+		require.Equal(v.err, c2.UnmarshalBinary(v.b), "UnmarshalBinary(): %s", v.name)
+	}
+
+	other := Kyber512
+	if p == Kyber512 {
+		other = Kyber768
+	}
+	_, skOther, err := other.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Other")
+	_, err = skOther.OpenCapsule(c)
+	require.Equal(ErrParameterSetMismatch, err, "OpenCapsule(): Mismatched ParameterSet")
+}
+
+func TestCapsuleKeyID(t *testing.T) {
+	require := require.New(t)
+
+	keys := make(map[[SymSize]byte]*PrivateKey)
+	var pks []*PublicKey
+	for _, p := range allParams {
+		pk, sk, err := p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "GenerateKeyPair(): %s", p.Name())
+		keys[pk.Fingerprint()] = sk
+		pks = append(pks, pk)
+	}
+
+	for _, pk := range pks {
+		p := pk.p
+		ct, ss, err := pk.KEMEncrypt(rand.Reader)
+		require.NoError(err, "%s: KEMEncrypt()", p.Name())
+
+		c, err := p.NewCapsule(ct, nil)
+		require.NoError(err, "%s: NewCapsule()", p.Name())
+		_, ok := c.KeyID()
+		require.False(ok, "%s: KeyID(): Unset", p.Name())
+		_, err = RouteCipherText(c, keys)
+		require.Equal(ErrUnknownRecipient, err, "%s: RouteCipherText(): No KeyID", p.Name())
+
+		require.NoError(c.SetKeyID(pk), "%s: SetKeyID()", p.Name())
+		keyID, ok := c.KeyID()
+		require.True(ok, "%s: KeyID()", p.Name())
+		require.Equal(pk.Fingerprint(), keyID, "%s: KeyID()", p.Name())
+
+		// The KeyID must survive serialization, with and without a
+		// shared secret.
+		for _, capSS := range [][]byte{nil, ss} {
+			c.sharedSecret = capSS
+			b, err := c.MarshalBinary()
+			require.NoError(err, "%s: MarshalBinary()", p.Name())
+			require.Len(b, marshalHeaderSize+1+p.CipherTextSize()+SymSize+len(capSS), "%s: MarshalBinary(): Length", p.Name())
+
+			var c2 Capsule
+			require.NoError(c2.UnmarshalBinary(b), "%s: UnmarshalBinary()", p.Name())
+			keyID, ok = c2.KeyID()
+			require.True(ok, "%s: UnmarshalBinary(): KeyID", p.Name())
+			require.Equal(pk.Fingerprint(), keyID, "%s: UnmarshalBinary(): KeyID", p.Name())
+			require.Equal(capSS, c2.SharedSecret(), "%s: UnmarshalBinary(): SharedSecret", p.Name())
+
+			sk, err := RouteCipherText(&c2, keys)
+			require.NoError(err, "%s: RouteCipherText()", p.Name())
+			requirePublicKeyEqual(require, pk, &sk.PublicKey)
+			ss2, err := sk.OpenCapsule(&c2)
+			require.NoError(err, "%s: OpenCapsule()", p.Name())
+			require.Equal(ss, ss2, "%s: OpenCapsule()", p.Name())
+
+			truncErr := ErrInvalidCapsule // Truncated KeyID.
+			if capSS != nil {
+				truncErr = ErrInvalidSharedSecretSize
+			}
+			require.Equal(truncErr, c2.UnmarshalBinary(b[:len(b)-1]), "%s: UnmarshalBinary(): Truncated", p.Name())
+			require.Equal(ErrInvalidCapsule, c2.UnmarshalBinary(append(b, 0)), "%s: UnmarshalBinary(): Trailing data", p.Name())
+		}
+
+		other := pks[0]
+		if other == pk {
+			other = pks[1]
+		}
+		require.Equal(ErrParameterSetMismatch, c.SetKeyID(other), "%s: SetKeyID(): Mismatched ParameterSet", p.Name())
+
+		_, err = RouteCipherText(c, map[[SymSize]byte]*PrivateKey{})
+		require.Equal(ErrUnknownRecipient, err, "%s: RouteCipherText(): Unknown KeyID", p.Name())
+	}
+}
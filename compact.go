@@ -0,0 +1,113 @@
+// compact.go - Kyber compact (QR code friendly) public key encoding.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalidCompactEncoding is the error returned when a compact encoded
+// public key is malformed.
+var ErrInvalidCompactEncoding = errors.New("kyber: invalid compact encoding")
+
+// base45Alphabet is the RFC 9285 Base45 alphabet, which is identical to the
+// QR code alphanumeric mode character set.
+const base45Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// CompactEncoding returns the compact encoding of a PublicKey, intended for
+// QR codes, which is the ParameterSet prefix ("KYBER512:", "KYBER768:", or
+// "KYBER1024:") followed by the RFC 9285 Base45 encoding of Bytes.
+//
+// As the encoding only uses the QR code alphanumeric mode character set,
+// it is more compact when rendered as a QR code than Base64 (which requires
+// byte mode), even though the string itself is longer.  At error correction
+// level L, this requires a version 20 (Kyber-512), version 24 (Kyber-768), or
+// version 28 (Kyber-1024) QR code.
+func (pk *PublicKey) CompactEncoding() string {
+	return compactPrefix(pk.p) + base45Encode(pk.Bytes())
+}
+
+// ParseCompactEncoding deserializes a PublicKey encoded via CompactEncoding,
+// with the ParameterSet selected by the prefix.
+func ParseCompactEncoding(s string) (*PublicKey, error) {
+	for _, p := range []*ParameterSet{Kyber512, Kyber768, Kyber1024} {
+		prefix := compactPrefix(p)
+		if !strings.HasPrefix(s, prefix) {
+			continue
+		}
+
+		b, err := base45Decode(s[len(prefix):])
+		if err != nil {
+			return nil, err
+		}
+
+		return p.PublicKeyFromBytes(b)
+	}
+
+	return nil, ErrInvalidCompactEncoding
+}
+
+func compactPrefix(p *ParameterSet) string {
+	// Eg: "Kyber-768" -> "KYBER768:".
+	return strings.ToUpper(strings.Replace(p.name, "-", "", -1)) + ":"
+}
+
+func base45Encode(b []byte) string {
+	var sb strings.Builder
+	sb.Grow((len(b)/2)*3 + (len(b)%2)*2)
+
+	for len(b) >= 2 {
+		n := int(b[0])<<8 | int(b[1])
+		sb.WriteByte(base45Alphabet[n%45])
+		sb.WriteByte(base45Alphabet[(n/45)%45])
+		sb.WriteByte(base45Alphabet[n/(45*45)])
+		b = b[2:]
+	}
+	if len(b) == 1 {
+		n := int(b[0])
+		sb.WriteByte(base45Alphabet[n%45])
+		sb.WriteByte(base45Alphabet[n/45])
+	}
+
+	return sb.String()
+}
+
+func base45Decode(s string) ([]byte, error) {
+	if len(s)%3 == 1 {
+		return nil, ErrInvalidCompactEncoding
+	}
+
+	vals := make([]int, len(s))
+	for i := 0; i < len(s); i++ {
+		v := strings.IndexByte(base45Alphabet, s[i])
+		if v < 0 {
+			return nil, ErrInvalidCompactEncoding
+		}
+		vals[i] = v
+	}
+
+	b := make([]byte, 0, (len(s)/3)*2+(len(s)%3)/2)
+	for len(vals) >= 3 {
+		n := vals[0] + vals[1]*45 + vals[2]*45*45
+		if n > 0xffff {
+			return nil, ErrInvalidCompactEncoding
+		}
+		b = append(b, byte(n>>8), byte(n))
+		vals = vals[3:]
+	}
+	if len(vals) == 2 {
+		n := vals[0] + vals[1]*45
+		if n > 0xff {
+			return nil, ErrInvalidCompactEncoding
+		}
+		b = append(b, byte(n))
+	}
+
+	return b, nil
+}
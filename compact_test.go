@@ -0,0 +1,75 @@
+// compact_test.go - Kyber compact public key encoding tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBase45(t *testing.T) {
+	require := require.New(t)
+
+	// RFC 9285 Section 4.3 examples.
+	for _, v := range []struct {
+		decoded, encoded string
+	}{
+		{"AB", "BB8"},
+		{"Hello!!", "%69 VD92EX0"},
+		{"base-45", "UJCLQE7W581"},
+		{"ietf!", "QED8WEX0"},
+		{"", ""},
+	} {
+		require.Equal(v.encoded, base45Encode([]byte(v.decoded)), "base45Encode(%q)", v.decoded)
+		b, err := base45Decode(v.encoded)
+		require.NoError(err, "base45Decode(%q)", v.encoded)
+		require.Equal(v.decoded, string(b), "base45Decode(%q)", v.encoded)
+	}
+
+	for _, s := range []string{
+		"GGW",  // 65536, out of range
+		"0",    // Invalid length
+		"abc",  // Invalid characters
+		"0000", // Invalid length
+		"ZZ",   // 2024, out of range for a single byte
+	} {
+		_, err := base45Decode(s)
+		require.Equal(ErrInvalidCompactEncoding, err, "base45Decode(%q)", s)
+	}
+}
+
+func TestCompactEncoding(t *testing.T) {
+	require := require.New(t)
+
+	for _, v := range []struct {
+		p      *ParameterSet
+		prefix string
+	}{
+		{Kyber512, "KYBER512:"},
+		{Kyber768, "KYBER768:"},
+		{Kyber1024, "KYBER1024:"},
+	} {
+		pk, _, err := v.p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "%s: GenerateKeyPair()", v.p.Name())
+
+		s := pk.CompactEncoding()
+		require.Equal(v.prefix, s[:len(v.prefix)], "%s: CompactEncoding(): Prefix", v.p.Name())
+		require.Len(s, len(v.prefix)+v.p.PublicKeySize()/2*3, "%s: CompactEncoding(): Length", v.p.Name())
+
+		pk2, err := ParseCompactEncoding(s)
+		require.NoError(err, "%s: ParseCompactEncoding()", v.p.Name())
+		requirePublicKeyEqual(require, pk, pk2)
+
+		_, err = ParseCompactEncoding(s[:len(s)-3])
+		require.Equal(ErrInvalidKeySize, err, "%s: ParseCompactEncoding(): Truncated", v.p.Name())
+		_, err = ParseCompactEncoding(s[len(v.prefix):])
+		require.Equal(ErrInvalidCompactEncoding, err, "%s: ParseCompactEncoding(): No prefix", v.p.Name())
+	}
+}
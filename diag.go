@@ -0,0 +1,199 @@
+// diag.go - Backend diagnostics.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+)
+
+const diagBenchIterations = 100
+
+// diagKATDigest is the SHA3-256 digest of the backend diagnostic transcript,
+// for the inputs derived from newDiagRng.
+var diagKATDigest, _ = hex.DecodeString("5efb256caf6e29ca256ad03255e194170948dffdec6d681e76da91dd18e28e75")
+
+// ErrBackendInconsistent is the error returned when the hardware accelerated
+// backend produces different output from the reference implementation.
+var ErrBackendInconsistent = errors.New("kyber: hardware acceleration backend is inconsistent with the reference")
+
+// BackendResult is the result of running diagnostics on an implementation
+// backend.
+type BackendResult struct {
+	// Name is the name of the backend (eg: "Reference", "AVX2").
+	Name string
+
+	// OK is true iff the backend produced the expected known-answer output.
+	OK bool
+
+	// NsPerOp is the mean time taken by the backend for the diagnostic
+	// workload (the noise sampling, NTT, matrix-vector multiplication, and
+	// inverse NTT of a Kyber-768 key generation), in nanoseconds.
+	NsPerOp int64
+}
+
+// RunBackendDiagnostics runs a known-answer test and a short benchmark of
+// the routines provided by every implementation backend supported by the
+// host, and returns the results.  The backend selected for general use is
+// neither changed nor used, so this is safe to call concurrently with other
+// operations.
+func RunBackendDiagnostics() []BackendResult {
+	in := newDiagInput()
+
+	var results []BackendResult
+	for _, impl := range supportedHardwareAccelImpls() {
+		results = append(results, runBackendDiagnostic(impl, in))
+	}
+
+	return results
+}
+
+// VerifyBackendConsistency runs the routines provided by the hardware
+// accelerated backend (if any) and the reference implementation on fixed
+// Kyber-768 sized inputs, and compares the output.  On a mismatch, hardware
+// acceleration is disabled (failing safe to the reference implementation),
+// and ErrBackendInconsistent is returned.
+//
+// This is intended to be called once at startup, as disabling hardware
+// acceleration is not safe to do concurrently with any other operation.
+func VerifyBackendConsistency() error {
+	if !isHardwareAccelerated {
+		return nil
+	}
+
+	in := newDiagInput()
+	if !bytes.Equal(diagTranscript(hardwareAccelImpl, in), diagTranscript(implReference, in)) {
+		forceDisableHardwareAcceleration()
+		return ErrBackendInconsistent
+	}
+
+	return nil
+}
+
+// diagInput is the fixed input to the backend diagnostic workload.
+type diagInput struct {
+	a     []polyVec
+	noise [][]byte
+}
+
+func newDiagInput() *diagInput {
+	rng := newDiagRng()
+	p := Kyber768
+
+	var seed [SymSize]byte
+	if _, err := io.ReadFull(rng, seed[:]); err != nil {
+		panic("kyber: failed to read diagnostic seed: " + err.Error())
+	}
+	in := &diagInput{a: p.allocMatrix()}
+	if err := genMatrix(in.a, seed[:], false); err != nil {
+		panic("kyber: failed to generate diagnostic matrix: " + err.Error())
+	}
+
+	// One noise buffer per supported eta, followed by one per element of s.
+	for _, eta := range []int{3, 4, 5} {
+		in.noise = append(in.noise, make([]byte, etaNoiseBufferSize(eta)))
+	}
+	for i := 0; i < p.k; i++ {
+		in.noise = append(in.noise, make([]byte, p.noiseBufferSize()))
+	}
+	for _, b := range in.noise {
+		if _, err := io.ReadFull(rng, b); err != nil {
+			panic("kyber: failed to read diagnostic noise: " + err.Error())
+		}
+	}
+
+	return in
+}
+
+// diagTranscript runs the diagnostic workload with the routines provided by
+// impl, and returns the serialized output.  The backend selected for general
+// use is not touched.
+func diagTranscript(impl *hwaccelImpl, in *diagInput) []byte {
+	p := Kyber768
+	var b []byte
+	appendPoly := func(pv *poly) {
+		var tmp [polySize]byte
+		pv.toBytes(tmp[:])
+		b = append(b, tmp[:]...)
+	}
+
+	// Noise sampling, for each supported eta.
+	for i, eta := range []int{3, 4, 5} {
+		var pv poly
+		impl.cbdFn(&pv, in.noise[i], eta)
+		appendPoly(&pv)
+	}
+
+	// The arithmetic of a key generation: s <- CBD, NTT(s), A * s, invNTT.
+	s := p.allocPolyVec()
+	for i, pv := range s.vec {
+		impl.cbdFn(pv, in.noise[3+i], p.eta)
+		impl.nttFn(&pv.coeffs)
+		appendPoly(pv)
+	}
+
+	t := p.allocPolyVec()
+	for i, pv := range t.vec {
+		impl.pointwiseAccFn(pv, &s, &in.a[i])
+		appendPoly(pv)
+		impl.invnttFn(&pv.coeffs)
+		appendPoly(pv)
+	}
+
+	return b
+}
+
+func runBackendDiagnostic(impl *hwaccelImpl, in *diagInput) BackendResult {
+	res := BackendResult{Name: impl.name}
+
+	digest := sum256(diagTranscript(impl, in))
+	res.OK = bytes.Equal(digest[:], diagKATDigest)
+
+	start := time.Now()
+	for i := 0; i < diagBenchIterations; i++ {
+		diagTranscript(impl, in)
+	}
+	res.NsPerOp = int64(time.Since(start)) / diagBenchIterations
+
+	return res
+}
+
+func newDiagRng() io.Reader {
+	return NewSHAKEReader([]byte("Kyber-BackendDiagnostics"))
+}
+
+// CountingReader is an io.Reader that counts the number of bytes read from
+// an underlying io.Reader, intended as a debugging aid for verifying the
+// amount of entropy consumed by an operation (eg: against KeyGenRandomSize
+// and EncapsulationRandomSize), when used as the rng argument.
+//
+// A CountingReader is not safe for concurrent use.
+type CountingReader struct {
+	r io.Reader
+	n uint64
+}
+
+// NewCountingReader returns a CountingReader that reads from r.
+func NewCountingReader(r io.Reader) *CountingReader {
+	return &CountingReader{r: r}
+}
+
+// Read reads from the underlying io.Reader, and counts the bytes read.
+func (r *CountingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += uint64(n)
+	return n, err
+}
+
+// BytesRead returns the total number of bytes read from the CountingReader.
+func (r *CountingReader) BytesRead() uint64 {
+	return r.n
+}
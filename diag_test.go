@@ -0,0 +1,88 @@
+// diag_test.go - Backend diagnostics tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackendDiagnostics(t *testing.T) {
+	require := require.New(t)
+
+	impl := hardwareAccelImpl
+	results := RunBackendDiagnostics()
+	require.Equal(impl, hardwareAccelImpl, "RunBackendDiagnostics(): Backend not restored")
+	require.Len(results, len(supportedHardwareAccelImpls()), "RunBackendDiagnostics(): Results")
+	require.Equal(implReference.name, results[0].Name, "RunBackendDiagnostics(): Reference")
+
+	for _, res := range results {
+		t.Logf("%s: OK: %v, %d ns/op", res.Name, res.OK, res.NsPerOp)
+		require.True(res.OK, "RunBackendDiagnostics(): %s", res.Name)
+		require.NotZero(res.NsPerOp, "RunBackendDiagnostics(): %s: NsPerOp", res.Name)
+	}
+
+	// A divergent backend must fail the known-answer test.
+	broken := newBrokenImpl()
+	res := runBackendDiagnostic(broken, newDiagInput())
+	require.False(res.OK, "runBackendDiagnostic(): Broken")
+	require.Equal(impl, hardwareAccelImpl, "runBackendDiagnostic(): Backend changed")
+}
+
+func newBrokenImpl() *hwaccelImpl {
+	broken := *implReference
+	broken.name = "Broken"
+	broken.nttFn = func(p *[kyberN]uint16) {
+		nttRef(p)
+		p[0] ^= 1
+	}
+	return &broken
+}
+
+func TestCountingReader(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range allParams {
+		rng := NewCountingReader(rand.Reader)
+		pk, _, err := p.GenerateKeyPair(rng)
+		require.NoError(err, "%s: GenerateKeyPair()", p.Name())
+		require.Equal(uint64(p.KeyGenRandomSize()), rng.BytesRead(), "%s: GenerateKeyPair(): BytesRead()", p.Name())
+
+		_, _, err = pk.KEMEncrypt(rng)
+		require.NoError(err, "%s: KEMEncrypt()", p.Name())
+		require.Equal(uint64(p.KeyGenRandomSize()+p.EncapsulationRandomSize()), rng.BytesRead(), "%s: KEMEncrypt(): BytesRead()", p.Name())
+	}
+}
+
+func TestVerifyBackendConsistency(t *testing.T) {
+	require := require.New(t)
+
+	defer func() {
+		forceDisableHardwareAcceleration()
+		if canAccelerate {
+			mustInitHardwareAcceleration()
+		}
+	}()
+
+	forceDisableHardwareAcceleration()
+	require.NoError(VerifyBackendConsistency(), "VerifyBackendConsistency(): Reference")
+
+	if canAccelerate {
+		mustInitHardwareAcceleration()
+		require.NoError(VerifyBackendConsistency(), "VerifyBackendConsistency(): Accelerated")
+		require.True(IsHardwareAccelerated(), "VerifyBackendConsistency(): Accelerated: Disabled")
+	}
+
+	// A divergent backend must be detected, and disabled.
+	hardwareAccelImpl, isHardwareAccelerated = newBrokenImpl(), true
+	require.Equal(ErrBackendInconsistent, VerifyBackendConsistency(), "VerifyBackendConsistency(): Broken")
+	require.False(IsHardwareAccelerated(), "VerifyBackendConsistency(): Broken: Still enabled")
+	require.Equal(implReference, hardwareAccelImpl, "VerifyBackendConsistency(): Broken: Backend")
+}
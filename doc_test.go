@@ -30,7 +30,7 @@ func Example_keyEncapsulationMechanism() {
 	}
 
 	// Bob, step 2: Generate the KEM cipher text and shared secret.
-	cipherText, bobSharedSecret, err := peerPublicKey.KEMEncrypt(rand.Reader)
+	cipherText, bobSharedSecret, err := peerPublicKey.KEMEncryptShared(rand.Reader)
 	if err != nil {
 		panic(err)
 	}
@@ -38,10 +38,10 @@ func Example_keyEncapsulationMechanism() {
 	// Bob, step 3: Send the cipher text to Alice (Not shown).
 
 	// Alice, step 3: Decrypt the KEM cipher text.
-	aliceSharedSecret := alicePrivateKey.KEMDecrypt(cipherText)
+	aliceSharedSecret := alicePrivateKey.KEMDecryptShared(cipherText)
 
 	// Alice and Bob have identical values for the shared secrets.
-	if bytes.Equal(aliceSharedSecret, bobSharedSecret) {
+	if !aliceSharedSecret.Equal(bobSharedSecret) {
 		panic("Shared secrets mismatch")
 	}
 }
@@ -68,7 +68,7 @@ func Example_keyExchangeUnilateralAuth() {
 	// Bob, step 2: Send the key exchange message to Alice (Not shown).
 
 	// Alice, step 1: Generates a responder message and shared secret.
-	aliceMessage, aliceSharedSecret := aliceStaticPrivateKey.UAKEResponderShared(rand.Reader, bobState.Message)
+	aliceMessage, aliceSharedSecret := Kyber768.UAKEResponderShared(rand.Reader, bobState.Message, aliceStaticPrivateKey)
 
 	// Alice, step 2: Send the responder message to Bob (Not shown).
 
@@ -109,7 +109,7 @@ func Example_keyExchangeMutualAuth() {
 	// Bob, step 2: Send the key exchange message to Alice (Not shown).
 
 	// Alice, step 1: Generates a responder message and shared secret.
-	aliceMessage, aliceSharedSecret := aliceStaticPrivateKey.AKEResponderShared(rand.Reader, bobState.Message, bobStaticPublicKey)
+	aliceMessage, aliceSharedSecret := Kyber768.AKEResponderShared(rand.Reader, bobState.Message, aliceStaticPrivateKey, bobStaticPublicKey)
 
 	// Alice, step 2: Send the responder message to Bob (Not shown).
 
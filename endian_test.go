@@ -0,0 +1,89 @@
+// endian_test.go - Kyber byte order independence tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// bigEndianArchs is the set of big-endian GOARCH values supported by the Go
+// toolchain.
+var bigEndianArchs = map[string]bool{
+	"mips":    true,
+	"mips64":  true,
+	"ppc64":   true,
+	"s390x":   true,
+	"armbe":   true,
+	"arm64be": true,
+	"sparc64": true,
+}
+
+// TestByteOrder checks that the serialization routines produce the
+// little-endian encodings specified by Kyber irrespective of the host byte
+// order, by comparing against hand computed encodings.
+//
+// All of the serialization is done with explicit shifts, so this (and
+// TestKEMVectors) should pass unmodified on big-endian hosts.  To exercise
+// that, run the full test suite under a big-endian GOARCH, eg:
+//
+//   GOARCH=s390x go test -exec qemu-s390x
+func TestByteOrder(t *testing.T) {
+	require := require.New(t)
+
+	if bigEndianArchs[runtime.GOARCH] {
+		t.Logf("Host is big-endian (%s).", runtime.GOARCH)
+	} else {
+		t.Logf("Host is little-endian (%s).", runtime.GOARCH)
+	}
+
+	t.Run("loadLittleEndian", func(t *testing.T) {
+		b := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+		require.Equal(uint64(0x0807060504030201), loadLittleEndian(b, 8), "loadLittleEndian(b, 8)")
+		require.Equal(uint64(0x030201), loadLittleEndian(b, 3), "loadLittleEndian(b, 3)")
+		require.Equal(uint64(0x04030201), loadLittleEndian(b, 4), "loadLittleEndian(b, 4)")
+	})
+
+	t.Run("poly.toBytes", func(t *testing.T) {
+		var p, p2 poly
+		p.coeffs[0] = 0x1234
+		p.coeffs[1] = 0x0001
+
+		b := make([]byte, polySize)
+		p.toBytes(b)
+		require.Equal([]byte{0x34, 0x32, 0x00, 0x00}, b[:4], "toBytes()")
+		for i, v := range b[4:] {
+			require.Zero(v, "toBytes(): Byte %d", i+4)
+		}
+
+		p2.fromBytes(b)
+		require.Equal(p.coeffs, p2.coeffs, "fromBytes()")
+	})
+
+	t.Run("poly.compress", func(t *testing.T) {
+		var p poly
+		p.coeffs[0] = kyberQ / 2 // Compresses to 4 (0b100).
+		p.coeffs[1] = kyberQ / 8 // Compresses to 1 (0b001).
+
+		b := make([]byte, polyCompressedSize)
+		p.compress(b)
+		require.Equal([]byte{0x0c, 0x00}, b[:2], "compress()")
+	})
+
+	t.Run("polyVec.compress", func(t *testing.T) {
+		v := &polyVec{vec: []*poly{new(poly)}}
+		v.vec[0].coeffs[0] = kyberQ / 2 // Compresses to 1024 (0x400).
+		v.vec[0].coeffs[1] = 3          // Compresses to 1 (0x001).
+
+		b := make([]byte, v.compressedSize())
+		v.compress(b)
+		require.Equal([]byte{0x00, 0x0c, 0x00}, b[:3], "compress()")
+	})
+}
@@ -0,0 +1,142 @@
+// hash.go - Pluggable SHA-3 family primitives.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	hashImpl HashProvider = defaultHashProvider{}
+
+	// hashImplGen is bumped every time the provider is changed, so that hash
+	// states cached in pooled scratch space can be recreated.
+	hashImplGen uint64
+)
+
+// HashProvider is a provider of the SHA-3 family of primitives used by
+// Kyber.  All implementations MUST be constant time.
+type HashProvider interface {
+	// NewShake128 returns a new SHAKE-128 instance.
+	NewShake128() sha3.ShakeHash
+
+	// NewShake256 returns a new SHAKE-256 instance.
+	NewShake256() sha3.ShakeHash
+
+	// New256 returns a new SHA3-256 instance.
+	New256() hash.Hash
+
+	// New512 returns a new SHA3-512 instance.
+	New512() hash.Hash
+}
+
+type defaultHashProvider struct{}
+
+func (defaultHashProvider) NewShake128() sha3.ShakeHash {
+	return sha3.NewShake128()
+}
+
+func (defaultHashProvider) NewShake256() sha3.ShakeHash {
+	return sha3.NewShake256()
+}
+
+func (defaultHashProvider) New256() hash.Hash {
+	return sha3.New256()
+}
+
+func (defaultHashProvider) New512() hash.Hash {
+	return sha3.New512()
+}
+
+// SetHashProvider overrides the SHA-3 family implementation used by the
+// package, with nil restoring the default (golang.org/x/crypto/sha3).
+//
+// This is not safe to call concurrently with any other operation, and
+// SHOULD be done once, during initialization.
+func SetHashProvider(h HashProvider) {
+	if h == nil {
+		h = defaultHashProvider{}
+	}
+	hashImpl = h
+	hashImplGen++
+}
+
+// The one-shot helpers bypass the HashProvider interface when the default
+// provider is in use, as the interface forces the hash state (and digest) to
+// be heap allocated, while the sha3 one-shot functions do not allocate with
+// recent versions of golang.org/x/crypto.
+
+func sum256(b []byte) [32]byte {
+	if _, ok := hashImpl.(defaultHashProvider); ok {
+		return sha3.Sum256(b)
+	}
+	return sum256Generic(b)
+}
+
+// The generic paths hash a copy of the input, as passing it to an interface
+// method would otherwise force the caller's buffer to the heap, even when
+// the default provider is in use.
+
+func sum256Generic(b []byte) (digest [32]byte) {
+	h := hashImpl.New256()
+	h.Write(append([]byte{}, b...))
+	h.Sum(digest[:0])
+	return
+}
+
+func sum512(b []byte) [64]byte {
+	if _, ok := hashImpl.(defaultHashProvider); ok {
+		return sha3.Sum512(b)
+	}
+	return sum512Generic(b)
+}
+
+func sum512Generic(b []byte) (digest [64]byte) {
+	h := hashImpl.New512()
+	h.Write(append([]byte{}, b...))
+	h.Sum(digest[:0])
+	return
+}
+
+func shakeSum256(hash, b []byte) {
+	if _, ok := hashImpl.(defaultHashProvider); ok {
+		sha3.ShakeSum256(hash, b)
+		return
+	}
+
+	xof := hashImpl.NewShake256()
+	xof.Write(b)
+	xof.Read(hash)
+}
+
+// NewSHAKEReader returns a deterministic io.Reader, that produces the
+// SHAKE-256 XOF output for the given seed, suitable for use as the rng
+// argument to any function in this package, to reproduce a sequence of
+// operations (eg: key generation, followed by many encapsulations).
+//
+// WARNING: The output is only as unpredictable as the seed, which MUST
+// contain at least 256 bits of entropy if the resulting keys and shared
+// secrets are to be used for anything other than testing.
+func NewSHAKEReader(seed []byte) io.Reader {
+	xof := hashImpl.NewShake256()
+	xof.Write(seed)
+	return &shakeReader{xof}
+}
+
+// shakeReader hides the XOF's other methods, so that callers can not Write
+// to (or Reset) it.
+type shakeReader struct {
+	xof io.Reader
+}
+
+func (r *shakeReader) Read(p []byte) (int, error) {
+	return r.xof.Read(p)
+}
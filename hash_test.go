@@ -0,0 +1,174 @@
+// hash_test.go - Pluggable SHA-3 provider tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"hash"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/sha3"
+)
+
+type countingHashProvider struct {
+	defaultHashProvider
+	n int
+
+	// Writes to the XOFs created by the provider.
+	nShake128, nShake256 int
+}
+
+type countingXOF struct {
+	sha3.ShakeHash
+	n *int
+}
+
+func (x *countingXOF) Write(p []byte) (int, error) {
+	*x.n++
+	return x.ShakeHash.Write(p)
+}
+
+func (c *countingHashProvider) NewShake128() sha3.ShakeHash {
+	c.n++
+	return &countingXOF{c.defaultHashProvider.NewShake128(), &c.nShake128}
+}
+
+func (c *countingHashProvider) NewShake256() sha3.ShakeHash {
+	c.n++
+	return &countingXOF{c.defaultHashProvider.NewShake256(), &c.nShake256}
+}
+
+func (c *countingHashProvider) New256() hash.Hash {
+	c.n++
+	return c.defaultHashProvider.New256()
+}
+
+func (c *countingHashProvider) New512() hash.Hash {
+	c.n++
+	return c.defaultHashProvider.New512()
+}
+
+func TestHashProvider(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range allParams {
+		// Derive the reference output with the default provider.
+		pk, sk, err := p.GenerateKeyPair(newTestRng())
+		require.NoError(err, "GenerateKeyPair()")
+		ct, ss, err := pk.KEMEncrypt(newTestRng())
+		require.NoError(err, "KEMEncrypt()")
+
+		// Ensure that every call site is routed through the provider, and
+		// that the output is unchanged.
+		c := new(countingHashProvider)
+		SetHashProvider(c)
+		pk2, sk2, err := p.GenerateKeyPair(newTestRng())
+		require.NoError(err, "GenerateKeyPair(): Custom")
+		ct2, ss2, err := pk2.KEMEncrypt(newTestRng())
+		require.NoError(err, "KEMEncrypt(): Custom")
+		n128, n256 := c.nShake128, c.nShake256
+		ss3 := sk2.KEMDecrypt(ct2)
+		SetHashProvider(nil)
+
+		// The XOFs cached in pooled scratch space must follow the provider,
+		// in both directions.
+		require.NotEqual(n128, c.nShake128, "KEMDecrypt(): Custom: Pooled SHAKE-128 not used")
+		require.NotEqual(n256, c.nShake256, "KEMDecrypt(): Custom: Pooled SHAKE-256 not used")
+		n128, n256 = c.nShake128, c.nShake256
+		require.Equal(ss, sk.KEMDecrypt(ct), "KEMDecrypt(): Default")
+		require.Equal(n128, c.nShake128, "KEMDecrypt(): Default: Stale pooled SHAKE-128 used")
+		require.Equal(n256, c.nShake256, "KEMDecrypt(): Default: Stale pooled SHAKE-256 used")
+
+		require.NotZero(c.n, "Provider not used")
+		require.Equal(sk.Bytes(), sk2.Bytes(), "sk: Custom")
+		require.Equal(ct, ct2, "ct: Custom")
+		require.Equal(ss, ss2, "ss: Custom")
+		require.Equal(ss, ss3, "KEMDecrypt(): Custom")
+		require.Equal(defaultHashProvider{}, hashImpl, "SetHashProvider(nil)")
+	}
+}
+
+func TestSHAKEReader(t *testing.T) {
+	require := require.New(t)
+
+	seed := []byte("TestSHAKEReader")
+
+	// The stream must be SHAKE-256(seed), irrespective of read sizes.
+	expected := make([]byte, 1000)
+	sha3.ShakeSum256(expected, seed)
+
+	r := NewSHAKEReader(seed)
+	b := make([]byte, len(expected))
+	for off, n := 0, 1; off < len(b); off, n = off+n, n+7 {
+		if off+n > len(b) {
+			n = len(b) - off
+		}
+		_, err := r.Read(b[off : off+n])
+		require.NoError(err, "Read()")
+	}
+	require.Equal(expected, b, "Read(): Output")
+
+	// Key generation must be reproducible.
+	pk, _, err := Kyber768.GenerateKeyPair(NewSHAKEReader(seed))
+	require.NoError(err, "GenerateKeyPair()")
+	pk2, _, err := Kyber768.GenerateKeyPair(NewSHAKEReader(seed))
+	require.NoError(err, "GenerateKeyPair(): Again")
+	requirePublicKeyEqual(require, pk, pk2)
+}
+
+func TestHashOneShot(t *testing.T) {
+	require := require.New(t)
+
+	b := []byte("TestHashOneShot")
+	d256, d512 := sum256(b), sum512(b)
+	var shake [64]byte
+	shakeSum256(shake[:], b)
+
+	// The default provider fast path must not allocate beyond what the sha3
+	// one-shot functions do (nothing, with recent versions).
+	for _, v := range []struct {
+		name      string
+		fn, oneFn func()
+	}{
+		{"sum256", func() { sum256(b) }, func() { sha3.Sum256(b) }},
+		{"sum512", func() { sum512(b) }, func() { sha3.Sum512(b) }},
+		{"shakeSum256", func() { shakeSum256(shake[:], b) }, func() { sha3.ShakeSum256(shake[:], b) }},
+	} {
+		n, expected := testing.AllocsPerRun(100, v.fn), testing.AllocsPerRun(100, v.oneFn)
+		require.Equal(expected, n, "%s(): Allocations", v.name)
+	}
+
+	// The fast path must match the generic path through the provider.
+	c := new(countingHashProvider)
+	SetHashProvider(c)
+	d256b, d512b := sum256(b), sum512(b)
+	var shakeB [64]byte
+	shakeSum256(shakeB[:], b)
+	SetHashProvider(nil)
+
+	require.Equal(3, c.n, "Provider not used")
+	require.Equal(d256, d256b, "sum256(): Custom")
+	require.Equal(d512, d512b, "sum512(): Custom")
+	require.Equal(shake, shakeB, "shakeSum256(): Custom")
+}
+
+func BenchmarkHashOneShot(b *testing.B) {
+	buf := make([]byte, Kyber768.PublicKeySize())
+	b.Run("sum256", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sum256(buf)
+		}
+	})
+	b.Run("sum512", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sum512(buf)
+		}
+	})
+}
@@ -254,3 +254,11 @@ func initHardwareAcceleration() {
 		hardwareAccelImpl = implAVX2
 	}
 }
+
+func supportedHardwareAccelImpls() []*hwaccelImpl {
+	impls := []*hwaccelImpl{implReference}
+	if supportsAVX2() {
+		impls = append(impls, implAVX2)
+	}
+	return impls
+}
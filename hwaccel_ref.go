@@ -12,3 +12,7 @@ package kyber
 func initHardwareAcceleration() {
 	forceDisableHardwareAcceleration()
 }
+
+func supportedHardwareAccelImpls() []*hwaccelImpl {
+	return []*hwaccelImpl{implReference}
+}
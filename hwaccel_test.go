@@ -0,0 +1,43 @@
+// hwaccel_test.go - Hardware acceleration hook tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferenceFallback(t *testing.T) {
+	require := require.New(t)
+
+	require.NotNil(implReference.nttFn, "implReference.nttFn")
+	require.NotNil(implReference.invnttFn, "implReference.invnttFn")
+	require.NotNil(implReference.pointwiseAccFn, "implReference.pointwiseAccFn")
+	require.NotNil(implReference.cbdFn, "implReference.cbdFn")
+	require.Equal(implReference, supportedHardwareAccelImpls()[0], "supportedHardwareAccelImpls(): Reference")
+
+	forceDisableHardwareAcceleration()
+	defer func() {
+		if canAccelerate {
+			mustInitHardwareAcceleration()
+		}
+	}()
+	require.Equal(implReference, hardwareAccelImpl, "forceDisableHardwareAcceleration(): Impl")
+	require.False(IsHardwareAccelerated(), "forceDisableHardwareAcceleration(): IsHardwareAccelerated()")
+
+	// The reference backend must be fully functional.
+	for _, p := range allParams {
+		pk, sk, err := p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "GenerateKeyPair(): %s", p.Name())
+		ct, ss, err := pk.KEMEncrypt(rand.Reader)
+		require.NoError(err, "KEMEncrypt(): %s", p.Name())
+		require.Equal(ss, sk.KEMDecrypt(ct), "KEMDecrypt(): %s", p.Name())
+	}
+}
@@ -37,12 +37,36 @@ func packCiphertext(r []byte, b *polyVec, v *poly) {
 }
 
 // De-serialize and decompress ciphertext from a byte array; approximate
-// inverse of packCiphertext.
+// inverse of packCiphertext.  The 11 bit (b) and 3 bit (v) encodings are
+// dense, so no input bits are ignored, and every input decompresses to
+// coefficients < kyberQ that compress back to the same input.
 func unpackCiphertext(b *polyVec, v *poly, c []byte) {
 	b.decompress(c)
 	v.decompress(c[b.compressedSize():])
 }
 
+// UnpackCiphertext de-serializes and decompresses a KEM cipher text, which is
+// the cipher text of the underlying IND-CPA encryption scheme, into the
+// polynomial vector b and the polynomial v, in the normal (non-NTT) domain.
+//
+// This is intended for analysis, and is not required to use the KEM.
+func (p *ParameterSet) UnpackCiphertext(cipherText []byte) (b []*Poly, v *Poly, err error) {
+	if len(cipherText) != p.cipherTextSize {
+		return nil, nil, ErrInvalidCipherTextSize
+	}
+
+	var vp poly
+	bp := p.allocPolyVec()
+	unpackCiphertext(&bp, &vp, cipherText)
+
+	b = make([]*Poly, 0, p.k)
+	for _, pv := range bp.vec {
+		b = append(b, pv.export())
+	}
+
+	return b, vp.export(), nil
+}
+
 // Serialize the secret key.
 func packSecretKey(r []byte, sk *polyVec) {
 	sk.toBytes(r)
@@ -53,20 +77,55 @@ func unpackSecretKey(sk *polyVec, packedSk []byte) {
 	sk.fromBytes(packedSk)
 }
 
+// maxMatrixBlocks is the maximum number of SHAKE-128 blocks that may be
+// squeezed to sample a single matrix entry.  An entry requires 256 of the
+// 84 candidates per block to be accepted with probability 7681/8192, so an
+// honest seed needs more than 4 blocks with negligible probability, and
+// 64 blocks is far beyond anything that is not adversarial.
+const maxMatrixBlocks = 64
+
 // Deterministically generate matrix A (or the transpose of A) from a seed.
 // Entries of the matrix are polynomials that look uniformly random. Performs
 // rejection sampling on output of SHAKE-128.
-func genMatrix(a []polyVec, seed []byte, transposed bool) {
-	const (
-		shake128Rate = 168 // xof.BlockSize() is not a constant.
-		maxBlocks    = 4
-	)
-	var buf [shake128Rate * maxBlocks]byte
-
-	var extSeed [SymSize + 2]byte
+//
+// To bound the worst-case runtime for adversarially chosen seeds (eg: in a
+// peer's public key), ErrMatrixGenerationFailed is returned if any entry
+// requires more than maxMatrixBlocks blocks of XOF output.
+func genMatrix(a []polyVec, seed []byte, transposed bool) error {
+	var s matrixSampler
+	return s.genMatrix(a, seed, transposed)
+}
+
+const (
+	shake128Rate        = 168 // xof.BlockSize() is not a constant.
+	matrixInitialBlocks = 4
+)
+
+// matrixSampler is the state used to generate the matrix, kept together so
+// that it can be reused via an indcpaScratch.  Everything in it is derived
+// from the public seed.
+type matrixSampler struct {
+	xof     sha3.ShakeHash
+	xofGen  uint64
+	buf     [shake128Rate * matrixInitialBlocks]byte
+	extSeed [SymSize + 2]byte
+}
+
+func (s *matrixSampler) genMatrix(a []polyVec, seed []byte, transposed bool) error {
+	buf, extSeed := s.buf[:], s.extSeed[:]
 	copy(extSeed[:SymSize], seed)
 
-	xof := sha3.NewShake128()
+	// A single XOF instance (and squeeze buffer) is used for the entire
+	// matrix, with Reset() between entries.  Absorbing the seed once and
+	// Clone()ing the state per entry would not save any permutations, as
+	// seed || i || j is shorter than the rate, and would add k^2
+	// allocations.
+	if s.xof == nil || s.xofGen != hashImplGen {
+		s.xof = hashImpl.NewShake128()
+		s.xofGen = hashImplGen
+	}
+	xof := s.xof
+	xof.Reset()
 
 	for i, v := range a {
 		for j, p := range v.vec {
@@ -81,28 +140,40 @@ func genMatrix(a []polyVec, seed []byte, transposed bool) {
 			xof.Write(extSeed[:])
 			xof.Read(buf[:])
 
-			for ctr, pos, maxPos := 0, 0, len(buf); ctr < kyberN; {
+			ctr, pos, maxPos := 0, 0, len(buf)
+			blocks, consumed := matrixInitialBlocks, 0
+			for ctr < kyberN {
 				val := (uint16(buf[pos]) | (uint16(buf[pos+1]) << 8)) & 0x1fff
 				if val < kyberQ {
 					p.coeffs[ctr] = val
 					ctr++
 				}
 				if pos += 2; pos == maxPos {
+					if blocks >= maxMatrixBlocks {
+						return ErrMatrixGenerationFailed
+					}
+
 					// On the unlikely chance 4 blocks is insufficient,
 					// incrementally squeeze out 1 block at a time.
 					xof.Read(buf[:shake128Rate])
+					consumed += maxPos
 					pos, maxPos = 0, shake128Rate
+					blocks++
 				}
 			}
+			if matrixStatsEnabled {
+				recordMatrixStats(len(a), blocks, (consumed+pos)/2)
+			}
 
 			xof.Reset()
 		}
 	}
+
+	return nil
 }
 
 type indcpaPublicKey struct {
 	packed []byte
-	h      [32]byte
 }
 
 func (pk *indcpaPublicKey) toBytes() []byte {
@@ -116,7 +187,6 @@ func (pk *indcpaPublicKey) fromBytes(p *ParameterSet, b []byte) error {
 
 	pk.packed = make([]byte, len(b))
 	copy(pk.packed, b)
-	pk.h = sha3.Sum256(b)
 
 	return nil
 }
@@ -151,14 +221,16 @@ func (p *ParameterSet) indcpaKeyPair(rng io.Reader) (*indcpaPublicKey, *indcpaSe
 		packed: make([]byte, p.indcpaPublicKeySize),
 	}
 
-	h := sha3.New512()
+	h := hashImpl.New512()
 	h.Write(buf[:SymSize])
 	buf = buf[:0] // Reuse the backing store.
 	buf = h.Sum(buf)
 	publicSeed, noiseSeed := buf[:SymSize], buf[SymSize:]
 
 	a := p.allocMatrix()
-	genMatrix(a, publicSeed, false)
+	if err := genMatrix(a, publicSeed, false); err != nil {
+		return nil, nil, err
+	}
 
 	var nonce byte
 	skpv := p.allocPolyVec()
@@ -184,79 +256,99 @@ func (p *ParameterSet) indcpaKeyPair(rng io.Reader) (*indcpaPublicKey, *indcpaSe
 	pkpv.invntt()
 	pkpv.add(&pkpv, &e)
 
+	if traceEnabled {
+		tracePolyVec("keypair/skpv", &skpv)
+		tracePolyVec("keypair/e", &e)
+		tracePolyVec("keypair/pkpv", &pkpv)
+	}
+
 	packSecretKey(sk.packed, &skpv)
 	packPublicKey(pk.packed, &pkpv, publicSeed)
-	pk.h = sha3.Sum256(pk.packed)
 
 	return pk, sk, nil
 }
 
 // Encryption function of the CPA-secure public-key encryption scheme
 // underlying Kyber.
-func (p *ParameterSet) indcpaEncrypt(c, m []byte, pk *indcpaPublicKey, coins []byte) {
-	var k, v, epp poly
+func (p *ParameterSet) indcpaEncrypt(c, m []byte, pk *indcpaPublicKey, coins []byte, s *indcpaScratch) error {
 	var seed [SymSize]byte
 
-	pkpv := p.allocPolyVec()
-	unpackPublicKey(&pkpv, seed[:], pk.packed)
-
-	k.fromMsg(m)
+	pkpv, at := &s.pkpv, s.at
+	unpackPublicKey(pkpv, seed[:], pk.packed)
 
 	pkpv.ntt()
 
-	at := p.allocMatrix()
-	genMatrix(at, seed[:], true)
+	if err := s.matrix.genMatrix(at, seed[:], true); err != nil {
+		return err
+	}
+
+	p.indcpaEncryptNTT(c, m, pkpv, at, coins, s)
+
+	return nil
+}
+
+// Encryption function of the CPA-secure public-key encryption scheme
+// underlying Kyber, given the public key polynomial vector in the NTT domain,
+// and the transposed matrix.
+func (p *ParameterSet) indcpaEncryptNTT(c, m []byte, pkpv *polyVec, at []polyVec, coins []byte, s *indcpaScratch) {
+	var k poly
+
+	sp, ep, bp, v, epp := &s.sp, &s.ep, &s.bp, &s.v, &s.epp
+
+	k.fromMsg(m)
 
 	var nonce byte
-	sp := p.allocPolyVec()
 	for _, pv := range sp.vec {
-		pv.getNoise(coins, nonce, p.eta)
+		s.getNoise(pv, coins, nonce, p.eta)
 		nonce++
 	}
 
 	sp.ntt()
 
-	ep := p.allocPolyVec()
 	for _, pv := range ep.vec {
-		pv.getNoise(coins, nonce, p.eta)
+		s.getNoise(pv, coins, nonce, p.eta)
 		nonce++
 	}
 
 	// matrix-vector multiplication
-	bp := p.allocPolyVec()
 	for i, pv := range bp.vec {
-		pv.pointwiseAcc(&sp, &at[i])
+		pv.pointwiseAcc(sp, &at[i])
 	}
 
 	bp.invntt()
-	bp.add(&bp, &ep)
+	bp.add(bp, ep)
 
-	v.pointwiseAcc(&pkpv, &sp)
+	v.pointwiseAcc(pkpv, sp)
 	v.invntt()
 
-	epp.getNoise(coins, nonce, p.eta) // Don't need to increment nonce.
+	s.getNoise(epp, coins, nonce, p.eta) // Don't need to increment nonce.
 
-	v.add(&v, &epp)
-	v.add(&v, &k)
+	v.add(v, epp)
+	v.add(v, &k)
 
-	packCiphertext(c, &bp, &v)
+	if traceEnabled {
+		tracePolyVec("encrypt/sp", sp)
+		tracePolyVec("encrypt/ep", ep)
+		tracePolyVec("encrypt/bp", bp)
+		tracePoly("encrypt/v", v)
+	}
+
+	packCiphertext(c, bp, v)
 }
 
 // Decryption function of the CPA-secure public-key encryption scheme
 // underlying Kyber.
-func (p *ParameterSet) indcpaDecrypt(m, c []byte, sk *indcpaSecretKey) {
-	var v, mp poly
-
-	skpv, bp := p.allocPolyVec(), p.allocPolyVec()
-	unpackCiphertext(&bp, &v, c)
-	unpackSecretKey(&skpv, sk.packed)
+func (p *ParameterSet) indcpaDecrypt(m, c []byte, sk *indcpaSecretKey, s *indcpaScratch) {
+	skpv, bp, v, mp := &s.skpv, &s.bp, &s.v, &s.mp
+	unpackCiphertext(bp, v, c)
+	unpackSecretKey(skpv, sk.packed)
 
 	bp.ntt()
 
-	mp.pointwiseAcc(&skpv, &bp)
+	mp.pointwiseAcc(skpv, bp)
 	mp.invntt()
 
-	mp.sub(&mp, &v)
+	mp.sub(mp, v)
 
 	mp.toMsg(m)
 }
@@ -277,3 +369,83 @@ func (p *ParameterSet) allocPolyVec() polyVec {
 
 	return polyVec{vec}
 }
+
+// indcpaScratch is the intermediate state used by indcpaEncrypt and
+// indcpaDecrypt, which may be pooled to avoid repeated allocation.
+type indcpaScratch struct {
+	pkpv, skpv, sp, ep, bp polyVec
+	at                     []polyVec
+	cmp                    []byte
+	matrix                 matrixSampler
+
+	v, mp, epp poly
+
+	// The noise sampler state, see getNoise.
+	shake    sha3.ShakeHash
+	shakeGen uint64
+	extSeed  [SymSize + 1]byte
+	noise    []byte
+}
+
+func (p *ParameterSet) allocIndcpaScratch() *indcpaScratch {
+	return &indcpaScratch{
+		pkpv:  p.allocPolyVec(),
+		skpv:  p.allocPolyVec(),
+		sp:    p.allocPolyVec(),
+		ep:    p.allocPolyVec(),
+		bp:    p.allocPolyVec(),
+		at:    p.allocMatrix(),
+		cmp:   make([]byte, p.cipherTextSize),
+		noise: make([]byte, etaNoiseBufferSize(p.eta)),
+	}
+}
+
+// getNoise is equivalent to pv.getNoise(seed, nonce, eta), but uses the
+// scratch buffers and a cached SHAKE-256 instance rather than allocating.
+func (s *indcpaScratch) getNoise(pv *poly, seed []byte, nonce byte, eta int) {
+	if s.shake == nil || s.shakeGen != hashImplGen {
+		s.shake = hashImpl.NewShake256()
+		s.shakeGen = hashImplGen
+	}
+
+	copy(s.extSeed[:], seed)
+	s.extSeed[SymSize] = nonce
+	buf := s.noise[:etaNoiseBufferSize(eta)]
+
+	s.shake.Reset()
+	s.shake.Write(s.extSeed[:])
+	s.shake.Read(buf)
+
+	pv.cbd(buf, eta)
+}
+
+// reset zeroes the secret-dependent scratch state, so that nothing sensitive
+// from a previous operation is visible to the next user of a pooled
+// indcpaScratch.
+//
+// pkpv and at only ever hold values derived from the public key, and are
+// entirely overwritten before use, so they are left as is, as clearing the
+// matrix dominates the cost of a reset.
+func (s *indcpaScratch) reset() {
+	for _, v := range []*polyVec{&s.skpv, &s.sp, &s.ep, &s.bp} {
+		v.reset()
+	}
+	for _, p := range []*poly{&s.v, &s.mp, &s.epp} {
+		p.reset()
+	}
+	zeroize(s.cmp)
+	zeroize(s.extSeed[:])
+	zeroize(s.noise)
+	if s.shake != nil {
+		s.shake.Reset()
+	}
+}
+
+func (p *ParameterSet) getScratch() *indcpaScratch {
+	return p.scratchPool.Get().(*indcpaScratch)
+}
+
+func (p *ParameterSet) putScratch(s *indcpaScratch) {
+	s.reset()
+	p.scratchPool.Put(s)
+}
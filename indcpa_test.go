@@ -0,0 +1,140 @@
+// indcpa_test.go - Kyber IND-CPA tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnpackCiphertextBoundary(t *testing.T) {
+	for _, p := range allParams {
+		t.Run(p.Name(), func(t *testing.T) { doTestUnpackCiphertextBoundary(t, p) })
+	}
+}
+
+func doTestUnpackCiphertextBoundary(t *testing.T, p *ParameterSet) {
+	require := require.New(t)
+
+	random := make([]byte, p.CipherTextSize())
+	_, err := rand.Read(random)
+	require.NoError(err, "rand.Read()")
+
+	patterns := map[string][]byte{
+		"Zeros":  make([]byte, p.CipherTextSize()),
+		"Ones":   bytes.Repeat([]byte{0xff}, p.CipherTextSize()),
+		"0xAA":   bytes.Repeat([]byte{0xaa}, p.CipherTextSize()),
+		"0x55":   bytes.Repeat([]byte{0x55}, p.CipherTextSize()),
+		"Random": random,
+	}
+
+	var v poly
+	bp := p.allocPolyVec()
+	for n, c := range patterns {
+		unpackCiphertext(&bp, &v, c)
+		for i, pv := range bp.vec {
+			for j, coeff := range pv.coeffs {
+				require.True(coeff < kyberQ, "%s: bp[%d][%d] out of range: %d", n, i, j, coeff)
+			}
+		}
+		for j, coeff := range v.coeffs {
+			require.True(coeff < kyberQ, "%s: v[%d] out of range: %d", n, j, coeff)
+		}
+
+		// Every input bit is significant, so this must round trip.
+		c2 := make([]byte, len(c))
+		packCiphertext(c2, &bp, &v)
+		require.Equal(c, c2, "%s: packCiphertext(unpackCiphertext(c))", n)
+
+		// The exported API must agree with the internal one.
+		b, vv, err := p.UnpackCiphertext(c)
+		require.NoError(err, "%s: UnpackCiphertext()", n)
+		require.Len(b, len(bp.vec), "%s: UnpackCiphertext(): len(b)", n)
+		for i, pv := range bp.vec {
+			require.Equal(Poly(pv.coeffs), *b[i], "%s: UnpackCiphertext(): b[%d]", n, i)
+		}
+		require.Equal(Poly(v.coeffs), *vv, "%s: UnpackCiphertext(): v", n)
+	}
+
+	_, _, err = p.UnpackCiphertext(random[1:])
+	require.Equal(ErrInvalidCipherTextSize, err, "UnpackCiphertext(): Truncated")
+}
+
+// BenchmarkGenMatrix measures matrix generation (SHAKE-128 and rejection
+// sampling) in isolation, for each parameter set and backend.  Matrix
+// generation currently does not use any of the accelerated routines, so
+// the backends are expected to perform identically until a SHAKE-128
+// accelerated path exists.
+func BenchmarkGenMatrix(b *testing.B) {
+	forceDisableHardwareAcceleration()
+	doBenchmarkGenMatrix(b)
+
+	if !canAccelerate {
+		b.Log("Hardware acceleration not supported on this host.")
+		return
+	}
+	mustInitHardwareAcceleration()
+	doBenchmarkGenMatrix(b)
+}
+
+func doBenchmarkGenMatrix(b *testing.B) {
+	impl := "_" + hardwareAccelImpl.name
+	for _, p := range allParams {
+		b.Run(p.Name()+impl, func(b *testing.B) { doBenchGenMatrix(b, p) })
+	}
+}
+
+func doBenchGenMatrix(b *testing.B, p *ParameterSet) {
+	var seed [SymSize]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		b.Fatalf("rand.Read(): %v", err)
+	}
+	a := p.allocMatrix()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := genMatrix(a, seed[:], true); err != nil {
+			b.Fatalf("genMatrix(): %v", err)
+		}
+	}
+}
+
+func TestMatrixGenStats(t *testing.T) {
+	require := require.New(t)
+
+	EnableMatrixGenStats(true)
+	defer EnableMatrixGenStats(false)
+
+	for _, p := range allParams {
+		var seed [SymSize]byte
+		_, err := rand.Read(seed[:])
+		require.NoError(err, "rand.Read()")
+
+		const nMatrices = 10
+		for i := 0; i < nMatrices; i++ {
+			genMatrix(p.allocMatrix(), seed[:], i&1 == 1)
+		}
+
+		stats := MatrixGenStats(p)
+		t.Logf("%s: %+v", p.Name(), stats)
+		require.Equal(uint64(nMatrices*p.k*p.k), stats.Entries, "%s: Entries", p.Name())
+		require.Equal(stats.Entries*kyberN, stats.Accepted, "%s: Accepted", p.Name())
+		require.True(stats.Blocks >= stats.Entries*4, "%s: Blocks", p.Name())
+		require.True(stats.Blocks < stats.Entries*maxMatrixBlocks, "%s: Blocks: Cap", p.Name())
+
+		// Each block yields 84 candidates, so the candidates must fit.
+		require.True(stats.Accepted+stats.Rejected <= stats.Blocks*84, "%s: Candidates", p.Name())
+	}
+
+	EnableMatrixGenStats(false)
+	require.Zero(MatrixGenStats(Kyber768), "EnableMatrixGenStats(false): Reset")
+}
@@ -11,9 +11,10 @@ import (
 	"bytes"
 	"crypto/subtle"
 	"errors"
+	"fmt"
 	"io"
-
-	"golang.org/x/crypto/sha3"
+	"sync"
+	"sync/atomic"
 )
 
 var (
@@ -28,9 +29,88 @@ var (
 	// ErrInvalidPrivateKey is the error returned when a byte serialized
 	// private key is malformed.
 	ErrInvalidPrivateKey = errors.New("kyber: invalid private key")
+
+	// ErrInvalidPublicKey is the error returned when a serialized public
+	// key, or values derived from it, are malformed.
+	ErrInvalidPublicKey = errors.New("kyber: invalid public key")
+
+	// ErrInvalidSecretKeyComponent is the error returned when the IND-CPA
+	// secret key component of a correctly sized byte serialized private key
+	// is malformed.  It wraps ErrInvalidPrivateKey.
+	ErrInvalidSecretKeyComponent = fmt.Errorf("%w: secret key component out of range", ErrInvalidPrivateKey)
+
+	// ErrInvalidPublicKeyComponent is the error returned when the public
+	// key component of a correctly sized byte serialized private key is
+	// malformed.  It wraps ErrInvalidPrivateKey.
+	ErrInvalidPublicKeyComponent = fmt.Errorf("%w: malformed public key component", ErrInvalidPrivateKey)
+
+	// ErrPublicKeyHashMismatch is the error returned when the H(pk)
+	// component of a correctly sized byte serialized private key does not
+	// match the public key component, ie: when either is corrupted.  It
+	// wraps ErrInvalidPublicKeyComponent.
+	ErrPublicKeyHashMismatch = fmt.Errorf("%w: H(pk) mismatch", ErrInvalidPublicKeyComponent)
+
+	// ErrInvalidZComponent is the error returned when the implicit
+	// rejection value z of a correctly sized byte serialized private key is
+	// malformed (all-zero).  It wraps ErrInvalidPrivateKey.
+	ErrInvalidZComponent = fmt.Errorf("%w: all-zero z component", ErrInvalidPrivateKey)
+
+	// ErrNilRandomSource is the error returned (or thrown via a panic) when
+	// a nil io.Reader is provided as the entropy source.
+	ErrNilRandomSource = errors.New("kyber: nil random source")
+
+	// ErrInvalidSharedSecretSize is the error returned when a shared secret
+	// destination buffer is an invalid size.
+	ErrInvalidSharedSecretSize = errors.New("kyber: invalid shared secret size")
+
+	// ErrBrokenRandomness is the error returned when the entropy source
+	// used for encapsulation returns a single repeated byte (eg: all-zero),
+	// which should never happen unless it is catastrophically broken.
+	ErrBrokenRandomness = errors.New("kyber: broken randomness")
+
+	// ErrDecapsulationFailure is the error returned by KEMDecryptExplicit
+	// when a cipher text fails the re-encryption check.
+	ErrDecapsulationFailure = errors.New("kyber: decapsulation failure")
+
+	// ErrFingerprintMismatch is the error returned when a public key does
+	// not match the expected fingerprint.
+	ErrFingerprintMismatch = errors.New("kyber: public key fingerprint mismatch")
+
+	// ErrInvalidSeedSize is the error returned when a caller provided seed
+	// is an invalid size.
+	ErrInvalidSeedSize = errors.New("kyber: invalid seed size")
+
+	// ErrMatrixGenerationFailed is the error returned when the matrix A
+	// derived from a public seed requires an implausible number of
+	// rejection sampling squeezes, which never happens for honestly
+	// generated keys.
+	ErrMatrixGenerationFailed = errors.New("kyber: matrix generation failed")
 )
 
+// SharedSecret is a Kyber shared secret.
+type SharedSecret [SharedSecretSize]byte
+
+// Equal returns true iff the SharedSecret is equal to other, in constant
+// time.  This SHOULD be used instead of bytes.Equal when comparing secrets.
+func (s *SharedSecret) Equal(other *SharedSecret) bool {
+	return subtle.ConstantTimeCompare(s[:], other[:]) == 1
+}
+
+// Zeroize overwrites the SharedSecret with zeros.  This SHOULD be called
+// once the SharedSecret has been consumed (eg: by a KDF).
+func (s *SharedSecret) Zeroize() {
+	zeroize(s[:])
+}
+
+// Bytes returns the byte serialization of a SharedSecret.
+func (s *SharedSecret) Bytes() []byte {
+	return s[:]
+}
+
 // PrivateKey is a Kyber private key.
+//
+// A PrivateKey is immutable after construction, and is safe for concurrent
+// use by multiple goroutines (eg: for decapsulation).
 type PrivateKey struct {
 	PublicKey
 	sk *indcpaSecretKey
@@ -44,13 +124,50 @@ func (sk *PrivateKey) Bytes() []byte {
 	b := make([]byte, 0, p.secretKeySize)
 	b = append(b, sk.sk.packed...)
 	b = append(b, sk.PublicKey.pk.packed...)
-	b = append(b, sk.PublicKey.pk.h[:]...)
+	h := sk.PublicKey.hash()
+	b = append(b, h[:]...)
 	b = append(b, sk.z...)
 
 	return b
 }
 
+// Zeroize overwrites the secret portions of a PrivateKey (the IND-CPA secret
+// key and the implicit rejection secret z) with zeros.  The PrivateKey MUST
+// NOT be used after it has been zeroized.
+func (sk *PrivateKey) Zeroize() {
+	zeroize(sk.sk.packed)
+	zeroize(sk.z)
+}
+
+// PublicKeyCopy returns a deep copy of the PublicKey corresponding to the
+// PrivateKey, that does not share any memory with the PrivateKey.
+func (sk *PrivateKey) PublicKeyCopy() *PublicKey {
+	pk := &PublicKey{
+		pk: &indcpaPublicKey{
+			packed: append([]byte{}, sk.PublicKey.pk.packed...),
+		},
+		p:  sk.PublicKey.p,
+		hc: new(publicKeyHash),
+	}
+	h := sk.PublicKey.hash()
+	pk.hc.once.Do(func() { pk.hc.h = h })
+
+	return pk
+}
+
 // PrivateKeyFromBytes deserializes a byte serialized PrivateKey.
+//
+// ErrInvalidKeySize is only returned if the serialized PrivateKey is the
+// wrong size.  A correctly sized PrivateKey with a malformed component is
+// rejected with an error wrapping ErrInvalidPrivateKey that identifies the
+// component: ErrInvalidSecretKeyComponent, ErrInvalidPublicKeyComponent (or
+// ErrPublicKeyHashMismatch), or ErrInvalidZComponent.
+//
+// Beyond the H(pk) consistency check, two encodings that Bytes never
+// produces are rejected: an IND-CPA secret key with a coefficient >= q,
+// which is outside the range the NTT and the reductions assume, and an
+// all-zero z, which is what a zeroized or never initialized key looks like
+// and would make implicit rejection predictable.
 func (p *ParameterSet) PrivateKeyFromBytes(b []byte) (*PrivateKey, error) {
 	if len(b) != p.secretKeySize {
 		return nil, ErrInvalidKeySize
@@ -61,31 +178,71 @@ func (p *ParameterSet) PrivateKeyFromBytes(b []byte) (*PrivateKey, error) {
 	sk.z = make([]byte, SymSize)
 	sk.PublicKey.pk = new(indcpaPublicKey)
 	sk.PublicKey.p = p
+	sk.PublicKey.hc = new(publicKeyHash)
 
-	// De-serialize the public key first.
+	// The IND-CPA secret key is a serialized polynomial vector, that must
+	// be fully reduced.  Every coefficient is checked, without branching
+	// on the (secret) values.
 	off := p.indcpaSecretKeySize
-	if err := sk.PublicKey.pk.fromBytes(p, b[off:off+p.publicKeySize]); err != nil {
+	skpv := p.allocPolyVec()
+	skpv.fromBytes(b[:off])
+	var unreduced uint32
+	for _, v := range skpv.vec {
+		for _, c := range v.coeffs {
+			unreduced |= (kyberQ - 1 - uint32(c)) >> 31
+		}
+	}
+	if unreduced != 0 {
+		return nil, ErrInvalidSecretKeyComponent
+	}
+	if err := sk.sk.fromBytes(p, b[:off]); err != nil {
 		return nil, err
 	}
+
+	// De-serialize the public key.
+	if err := sk.PublicKey.pk.fromBytes(p, b[off:off+p.publicKeySize]); err != nil {
+		return nil, ErrInvalidPublicKeyComponent
+	}
 	off += p.publicKeySize
-	if !bytes.Equal(sk.PublicKey.pk.h[:], b[off:off+SymSize]) {
-		return nil, ErrInvalidPrivateKey
+	if h := sk.PublicKey.hash(); !bytes.Equal(h[:], b[off:off+SymSize]) {
+		return nil, ErrPublicKeyHashMismatch
 	}
 	off += SymSize
-	copy(sk.z, b[off:])
-
-	// Then go back to de-serialize the private key.
-	if err := sk.sk.fromBytes(p, b[:p.indcpaSecretKeySize]); err != nil {
-		return nil, err
+	if isAllZero(b[off:]) {
+		return nil, ErrInvalidZComponent
 	}
+	copy(sk.z, b[off:])
 
 	return sk, nil
 }
 
 // PublicKey is a Kyber public key.
+//
+// A PublicKey is immutable after construction, and is safe for concurrent
+// use by multiple goroutines (eg: for encapsulation).
 type PublicKey struct {
 	pk *indcpaPublicKey
 	p  *ParameterSet
+
+	// hc caches H(pk), which is computed on first use by hash, as many
+	// callers deserialize public keys that are never used to encapsulate
+	// or fingerprinted.
+	hc *publicKeyHash
+}
+
+type publicKeyHash struct {
+	once sync.Once
+	h    [32]byte
+}
+
+// hash returns H(pk), computing and caching it if required.  It is safe to
+// call concurrently.
+func (pk *PublicKey) hash() [32]byte {
+	if pk.hc == nil {
+		return sum256(pk.pk.packed)
+	}
+	pk.hc.once.Do(func() { pk.hc.h = sum256(pk.pk.packed) })
+	return pk.hc.h
 }
 
 // Bytes returns the byte serialization of a PublicKey.
@@ -94,10 +251,16 @@ func (pk *PublicKey) Bytes() []byte {
 }
 
 // PublicKeyFromBytes deserializes a byte serialized PublicKey.
+//
+// Every correctly sized byte string is a valid public key, as the 11 bit
+// compressed polynomial vector encoding is dense (each encoding decompresses
+// to distinct coefficients < q), and the matrix seed is arbitrary, so no
+// validation beyond the length is possible.
 func (p *ParameterSet) PublicKeyFromBytes(b []byte) (*PublicKey, error) {
 	pk := &PublicKey{
 		pk: new(indcpaPublicKey),
 		p:  p,
+		hc: new(publicKeyHash),
 	}
 
 	if err := pk.pk.fromBytes(p, b); err != nil {
@@ -107,9 +270,81 @@ func (p *ParameterSet) PublicKeyFromBytes(b []byte) (*PublicKey, error) {
 	return pk, nil
 }
 
+// BytesWithoutSeed returns the byte serialization of a PublicKey, omitting
+// the public matrix seed.  This is intended for deployments where all keys
+// share a common matrix A, and the seed is distributed out of band.  The
+// returned slice is a copy, and may be modified by the caller.
+func (pk *PublicKey) BytesWithoutSeed() []byte {
+	return append([]byte{}, pk.pk.packed[:pk.p.polyVecCompressedSize]...)
+}
+
+// PublicKeyFromBytesWithSeed deserializes a PublicKey serialized without the
+// public matrix seed (via BytesWithoutSeed), re-attaching the provided seed.
+func (p *ParameterSet) PublicKeyFromBytesWithSeed(body, seed []byte) (*PublicKey, error) {
+	if len(body) != p.polyVecCompressedSize || len(seed) != SymSize {
+		return nil, ErrInvalidKeySize
+	}
+
+	b := make([]byte, 0, p.publicKeySize)
+	b = append(b, body...)
+	b = append(b, seed...)
+
+	return p.PublicKeyFromBytes(b)
+}
+
+// Fingerprint returns the fingerprint of a PublicKey, which is H(pk), the
+// SHA3-256 digest of the byte serialized PublicKey.
+func (pk *PublicKey) Fingerprint() [SymSize]byte {
+	return pk.hash()
+}
+
+// Commitment returns a SymSize byte commitment to a PublicKey, that is
+// SHAKE-256(salt || pk.Bytes()), for use in commit-reveal protocols where a
+// party publishes a commitment to its public key before the peer reveals
+// theirs, to prevent adaptive key selection.
+//
+// The salt SHOULD be SymSize bytes of fresh entropy, and is revealed along
+// with the PublicKey.
+func (pk *PublicKey) Commitment(salt []byte) []byte {
+	xof := hashImpl.NewShake256()
+	xof.Write(salt)
+	xof.Write(pk.pk.packed)
+
+	commitment := make([]byte, SymSize)
+	xof.Read(commitment)
+
+	return commitment
+}
+
+// VerifyCommitment returns true iff commitment is the commitment to the
+// PublicKey with the given salt, in constant time.
+func VerifyCommitment(commitment, salt []byte, pk *PublicKey) bool {
+	return subtle.ConstantTimeCompare(commitment, pk.Commitment(salt)) == 1
+}
+
+// PublicKeyFromBytesWithFingerprint deserializes a byte serialized PublicKey,
+// and checks that it matches the expected fingerprint (eg: one pinned on
+// first use), returning ErrFingerprintMismatch if it does not.
+func (p *ParameterSet) PublicKeyFromBytesWithFingerprint(b []byte, expectedFingerprint [SymSize]byte) (*PublicKey, error) {
+	pk, err := p.PublicKeyFromBytes(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if h := pk.hash(); subtle.ConstantTimeCompare(h[:], expectedFingerprint[:]) != 1 {
+		return nil, ErrFingerprintMismatch
+	}
+
+	return pk, nil
+}
+
 // GenerateKeyPair generates a private and public key parameterized with the
 // given ParameterSet.
 func (p *ParameterSet) GenerateKeyPair(rng io.Reader) (*PublicKey, *PrivateKey, error) {
+	if rng == nil {
+		return nil, nil, ErrNilRandomSource
+	}
+
 	kp := new(PrivateKey)
 
 	var err error
@@ -118,6 +353,7 @@ func (p *ParameterSet) GenerateKeyPair(rng io.Reader) (*PublicKey, *PrivateKey,
 	}
 
 	kp.PublicKey.p = p
+	kp.PublicKey.hc = new(publicKeyHash)
 	kp.z = make([]byte, SymSize)
 	if _, err := io.ReadFull(rng, kp.z); err != nil {
 		return nil, nil, err
@@ -126,32 +362,251 @@ func (p *ParameterSet) GenerateKeyPair(rng io.Reader) (*PublicKey, *PrivateKey,
 	return &kp.PublicKey, kp, nil
 }
 
+// GenerateSerializedKeyPair generates a private and public key parameterized
+// with the given ParameterSet, and returns their byte serializations.  The
+// intermediate PrivateKey is zeroized before returning, so the only copy of
+// the private key is privBytes.
+func (p *ParameterSet) GenerateSerializedKeyPair(rng io.Reader) (pubBytes, privBytes []byte, err error) {
+	pk, sk, err := p.GenerateKeyPair(rng)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pubBytes = append([]byte{}, pk.Bytes()...)
+	privBytes = sk.Bytes() // Always a fresh copy.
+	sk.Zeroize()
+
+	return
+}
+
+// KeyPairFromSeed deterministically derives a private and public key
+// parameterized with the given ParameterSet from a KeyGenRandomSize byte
+// seed, such that the output is identical to GenerateKeyPair with an
+// io.Reader that returns the seed.
+//
+// The seed is equivalent to the private key, and MUST be kept secret.
+func (p *ParameterSet) KeyPairFromSeed(seed []byte) (*PublicKey, *PrivateKey, error) {
+	if len(seed) != p.KeyGenRandomSize() {
+		return nil, nil, ErrInvalidSeedSize
+	}
+
+	return p.GenerateKeyPair(bytes.NewReader(seed))
+}
+
+// VerifyPublicKeyFromSeed returns true iff the PublicKey is the one derived
+// from the seed via KeyPairFromSeed, comparing the serialized public keys in
+// constant time, eg: to audit deployed keys against escrowed seeds.
+func (p *ParameterSet) VerifyPublicKeyFromSeed(seed []byte, pk *PublicKey) (bool, error) {
+	if pk.p != p {
+		return false, ErrParameterSetMismatch
+	}
+
+	derivedPk, derivedSk, err := p.KeyPairFromSeed(seed)
+	if err != nil {
+		return false, err
+	}
+	defer derivedSk.Zeroize()
+
+	return subtle.ConstantTimeCompare(derivedPk.Bytes(), pk.Bytes()) == 1, nil
+}
+
 // KEMEncrypt generates cipher text and shared secret via the CCA-secure Kyber
 // key encapsulation mechanism.
+//
+// KEMEncrypt does not modify the PublicKey, and may be called concurrently
+// on the same PublicKey from multiple goroutines, as long as rng is safe for
+// concurrent use (eg: crypto/rand.Reader).
+//
+// As a defense-in-depth measure, ErrBrokenRandomness is returned if the
+// entropy read from rng is a single repeated byte (eg: all-zero), as
+// returned by a stuck or uninitialized source.
 func (pk *PublicKey) KEMEncrypt(rng io.Reader) (cipherText []byte, sharedSecret []byte, err error) {
+	return pk.kemEncrypt(rng, true, nil)
+}
+
+// KEMEncryptNoCTHash generates cipher text and shared secret via a variant of
+// the Kyber key encapsulation mechanism that omits H(c) from the shared
+// secret derivation, as in some earlier revisions of Kyber.
+//
+// WARNING: This is weaker than KEMEncrypt as the shared secret is not bound
+// to the cipher text, and is ONLY intended for interoperability with legacy
+// peers.  New protocols MUST use KEMEncrypt.
+func (pk *PublicKey) KEMEncryptNoCTHash(rng io.Reader) (cipherText []byte, sharedSecret []byte, err error) {
+	return pk.kemEncrypt(rng, false, nil)
+}
+
+func (pk *PublicKey) kemEncrypt(rng io.Reader, withCTHash bool, pre *PrecomputedPublicKey) (cipherText []byte, sharedSecret []byte, err error) {
+	if rng == nil {
+		return nil, nil, ErrNilRandomSource
+	}
+
 	var buf [SymSize]byte
 	if _, err = io.ReadFull(rng, buf[:]); err != nil {
 		return nil, nil, err
 	}
-	buf = sha3.Sum256(buf[:]) // Don't release system RNG output
+	// Cheap canary, to avoid handing a known key to the caller's AEAD.
+	if isRepeatedByte(buf[:]) {
+		return nil, nil, ErrBrokenRandomness
+	}
+	buf = sum256(buf[:]) // Don't release system RNG output
 
-	hKr := sha3.New512()
+	return pk.kemEncryptMessage(&buf, withCTHash, pre)
+}
+
+func (pk *PublicKey) kemEncryptMessage(buf *[SymSize]byte, withCTHash bool, pre *PrecomputedPublicKey) (cipherText []byte, sharedSecret []byte, err error) {
+	hKr := hashImpl.New512()
 	hKr.Write(buf[:])
-	hKr.Write(pk.pk.h[:]) // Multitarget countermeasures for coins + contributory KEM
+	h := pk.hash()
+	hKr.Write(h[:]) // Multitarget countermeasures for coins + contributory KEM
 	kr := hKr.Sum(nil)
 
 	cipherText = make([]byte, pk.p.cipherTextSize)
-	pk.p.indcpaEncrypt(cipherText, buf[:], pk.pk, kr[SymSize:]) // coins are in kr[SymSize:]
+	s := pk.p.getScratch()
+	defer pk.p.putScratch(s)
+	if pre != nil {
+		pk.p.indcpaEncryptNTT(cipherText, buf[:], &pre.pkpv, pre.at, kr[SymSize:], s) // coins are in kr[SymSize:]
+	} else {
+		if err = pk.p.indcpaEncrypt(cipherText, buf[:], pk.pk, kr[SymSize:], s); err != nil { // coins are in kr[SymSize:]
+			return nil, nil, err
+		}
+	}
 
-	hc := sha3.Sum256(cipherText)
-	copy(kr[SymSize:], hc[:]) // overwrite coins in kr with H(c)
-	hSs := sha3.New256()
-	hSs.Write(kr)
-	sharedSecret = hSs.Sum(nil) // hash concatenation of pre-k and H(c) to k
+	hSs := hashImpl.New256()
+	if withCTHash {
+		hc := sum256(cipherText)
+		copy(kr[SymSize:], hc[:]) // overwrite coins in kr with H(c)
+		hSs.Write(kr)
+	} else {
+		hSs.Write(kr[:SymSize])
+	}
+	sharedSecret = hSs.Sum(nil) // hash concatenation of pre-k and H(c) (if any) to k
 
 	return
 }
 
+// KEMEncryptHedged generates cipher text and shared secret via the CCA-secure
+// Kyber key encapsulation mechanism, with the message seed derived as
+// SHAKE-256(rng output || staticSeed || H(pk)) instead of from the rng
+// output alone.  This keeps encapsulation secure even if rng is completely
+// predictable (eg: on embedded devices), as long as staticSeed is secret.
+//
+// The staticSeed (eg: a device-unique secret) MUST be at least SymSize
+// bytes in length, and MUST be kept secret.
+func (pk *PublicKey) KEMEncryptHedged(rng io.Reader, staticSeed []byte) (cipherText []byte, sharedSecret []byte, err error) {
+	if rng == nil {
+		return nil, nil, ErrNilRandomSource
+	}
+	if len(staticSeed) < SymSize {
+		return nil, nil, ErrInvalidSeedSize
+	}
+
+	var buf [SymSize]byte
+	if _, err = io.ReadFull(rng, buf[:]); err != nil {
+		return nil, nil, err
+	}
+
+	xof := hashImpl.NewShake256()
+	xof.Write(buf[:])
+	xof.Write(staticSeed)
+	h := pk.hash()
+	xof.Write(h[:])
+	xof.Read(buf[:])
+
+	return pk.kemEncryptMessage(&buf, true, nil)
+}
+
+// KEMEncryptPadded is KEMEncrypt, except that the cipher text is padded with
+// random bytes to MaxCipherTextSize, so that cipher texts of every supported
+// ParameterSet are the same length on the wire.  The padding is discarded by
+// KEMDecryptPadded, and does not influence the shared secret.
+//
+// Note that this only hides the parameter set from length based traffic
+// analysis, and that the padding is not authenticated.
+func (pk *PublicKey) KEMEncryptPadded(rng io.Reader) (cipherText []byte, sharedSecret []byte, err error) {
+	var ct []byte
+	if ct, sharedSecret, err = pk.KEMEncrypt(rng); err != nil {
+		return nil, nil, err
+	}
+
+	cipherText = make([]byte, MaxCipherTextSize)
+	copy(cipherText, ct)
+	if _, err = io.ReadFull(rng, cipherText[len(ct):]); err != nil {
+		zeroize(sharedSecret)
+		return nil, nil, err
+	}
+
+	return
+}
+
+// isAllZero returns true iff b consists entirely of zero bytes, in constant
+// time.
+func isAllZero(b []byte) bool {
+	var acc byte
+	for _, v := range b {
+		acc |= v
+	}
+
+	return subtle.ConstantTimeByteEq(acc, 0) == 1
+}
+
+// isRepeatedByte returns true iff b consists entirely of copies of a single
+// byte value, in constant time.
+func isRepeatedByte(b []byte) bool {
+	if len(b) == 0 {
+		return true
+	}
+
+	var acc byte
+	for _, v := range b {
+		acc |= v ^ b[0]
+	}
+
+	return subtle.ConstantTimeByteEq(acc, 0) == 1
+}
+
+// KEMEncryptShared is KEMEncrypt, except that the shared secret is returned
+// as a SharedSecret.
+func (pk *PublicKey) KEMEncryptShared(rng io.Reader) (cipherText []byte, sharedSecret *SharedSecret, err error) {
+	var ss []byte
+	if cipherText, ss, err = pk.KEMEncrypt(rng); err != nil {
+		return nil, nil, err
+	}
+
+	sharedSecret = new(SharedSecret)
+	copy(sharedSecret[:], ss)
+
+	return
+}
+
+// Encapsulation is a Kyber cipher text and the corresponding shared secret.
+type Encapsulation struct {
+	// CipherText is the cipher text to send to the holder of the private
+	// key.
+	CipherText []byte
+
+	// SharedSecret is the shared secret.
+	SharedSecret *SharedSecret
+}
+
+// Zeroize overwrites the shared secret of the Encapsulation with zeros.
+func (e *Encapsulation) Zeroize() {
+	e.SharedSecret.Zeroize()
+}
+
+// Encapsulate is KEMEncrypt, except that the cipher text and shared secret
+// are returned as an Encapsulation.
+func (pk *PublicKey) Encapsulate(rng io.Reader) (*Encapsulation, error) {
+	cipherText, sharedSecret, err := pk.KEMEncryptShared(rng)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encapsulation{
+		CipherText:   cipherText,
+		SharedSecret: sharedSecret,
+	}, nil
+}
+
 // KEMDecrypt generates shared secret for given cipher text via the CCA-secure
 // Kyber key encapsulation mechanism.
 //
@@ -159,29 +614,264 @@ func (pk *PublicKey) KEMEncrypt(rng io.Reader) (cipherText []byte, sharedSecret
 // cipher text that is obviously malformed (too large/small) will result in a
 // panic.
 func (sk *PrivateKey) KEMDecrypt(cipherText []byte) (sharedSecret []byte) {
-	var buf [2 * SymSize]byte
+	sharedSecret = make([]byte, SharedSecretSize)
+	if err := sk.KEMDecryptInto(sharedSecret, cipherText); err != nil {
+		panic(err)
+	}
+
+	return
+}
+
+// KEMDecryptShared is KEMDecrypt, except that the shared secret is returned
+// as a SharedSecret.
+func (sk *PrivateKey) KEMDecryptShared(cipherText []byte) (sharedSecret *SharedSecret) {
+	sharedSecret = new(SharedSecret)
+	if err := sk.KEMDecryptInto(sharedSecret[:], cipherText); err != nil {
+		panic(err)
+	}
+
+	return
+}
+
+// Decapsulator is a Kyber private key that can decapsulate cipher texts,
+// that allows the long term private key to be held externally (eg: in a
+// HSM) for the key exchange responder functions.  PrivateKey implements
+// Decapsulator.
+//
+// Implementations MUST use implicit rejection (ie: return a pseudorandom
+// shared secret, and no error, on a decapsulation failure) as KEMDecrypt
+// does, and SHOULD only return an error on a malformed cipher text or an
+// operational failure.
+type Decapsulator interface {
+	// Decapsulate generates the shared secret for a cipher text.
+	Decapsulate(cipherText []byte) ([]byte, error)
+}
+
+var _ Decapsulator = (*PrivateKey)(nil)
+
+// Decapsulate is KEMDecrypt, except that a malformed cipher text results in
+// ErrInvalidCipherTextSize instead of a panic, so that a PrivateKey can be
+// used as a Decapsulator.
+func (sk *PrivateKey) Decapsulate(cipherText []byte) ([]byte, error) {
+	if len(cipherText) != sk.PublicKey.p.cipherTextSize {
+		return nil, ErrInvalidCipherTextSize
+	}
 
+	return sk.KEMDecrypt(cipherText), nil
+}
+
+// KEMDecryptPadded generates shared secret for a cipher text produced by
+// KEMEncryptPadded, by stripping the padding based on the PrivateKey's
+// ParameterSet, and is otherwise identical to KEMDecrypt.  Cipher texts that
+// are not MaxCipherTextSize bytes are rejected with ErrInvalidCipherTextSize.
+func (sk *PrivateKey) KEMDecryptPadded(cipherText []byte) ([]byte, error) {
+	if len(cipherText) != MaxCipherTextSize {
+		return nil, ErrInvalidCipherTextSize
+	}
+
+	return sk.KEMDecrypt(cipherText[:sk.PublicKey.p.cipherTextSize]), nil
+}
+
+// KEMDecryptInto generates shared secret for given cipher text via the
+// CCA-secure Kyber key encapsulation mechanism, and writes it to dst, which
+// MUST be SharedSecretSize bytes in length.  Intermediate buffers are pooled
+// per ParameterSet, so steady-state decapsulation does not allocate them.
+//
+// On failures, dst will contain a randomized value.  Providing a cipher text
+// that is obviously malformed (too large/small) will return
+// ErrInvalidCipherTextSize.
+func (sk *PrivateKey) KEMDecryptInto(dst, cipherText []byte) error {
+	return sk.kemDecryptInto(dst, cipherText, true)
+}
+
+// KEMDecryptNoCTHash generates shared secret for given cipher text via the
+// Kyber key encapsulation mechanism variant used by KEMEncryptNoCTHash.
+//
+// WARNING: This is weaker than KEMDecrypt, and is ONLY intended for
+// interoperability with legacy peers.  On failures, sharedSecret will
+// contain a randomized value, derived from the private key and the cipher
+// text.  Providing a cipher text that is obviously malformed (too
+// large/small) will result in a panic.
+func (sk *PrivateKey) KEMDecryptNoCTHash(cipherText []byte) (sharedSecret []byte) {
+	sharedSecret = make([]byte, SharedSecretSize)
+	if err := sk.kemDecryptInto(sharedSecret, cipherText, false); err != nil {
+		panic(err)
+	}
+
+	return
+}
+
+func (sk *PrivateKey) kemDecryptInto(dst, cipherText []byte, withCTHash bool) error {
 	p := sk.PublicKey.p
+	if len(dst) != SharedSecretSize {
+		return ErrInvalidSharedSecretSize
+	}
 	if len(cipherText) != p.CipherTextSize() {
-		panic(ErrInvalidCipherTextSize)
+		return ErrInvalidCipherTextSize
 	}
-	p.indcpaDecrypt(buf[:SymSize], cipherText, sk.sk)
 
-	copy(buf[SymSize:], sk.PublicKey.pk.h[:]) // Multitarget countermeasure for coins + contributory KEM
-	kr := sha3.Sum512(buf[:])
+	kr, fail := sk.reencrypt(cipherText)
+	recordDecapsulationRejection(fail)
+
+	hc := sum256(cipherText)
+	if withCTHash {
+		copy(kr[SymSize:], hc[:]) // overwrite coins in kr with H(c)
+
+		subtle.ConstantTimeCopy(fail, kr[SymSize:], sk.z) // Overwrite pre-k with z on re-encryption failure
+		ss := sum256(kr[:])
+		copy(dst, ss[:])
+		zeroize(ss[:])
+	} else {
+		// The shared secret is H(pre-k), which does not depend on the
+		// cipher text, so the rejection value is H(z || H(c)) to keep it
+		// bound to the cipher text.  Both are always computed, and the
+		// result is selected in constant time.
+		ss := sum256(kr[:SymSize])
+		copy(kr[:SymSize], sk.z)
+		copy(kr[SymSize:], hc[:])
+		rej := sum256(kr[:])
+		subtle.ConstantTimeCopy(fail, ss[:], rej[:])
+		copy(dst, ss[:])
+		zeroize(ss[:])
+		zeroize(rej[:])
+	}
+	zeroize(kr[:])
 
-	cmp := make([]byte, p.cipherTextSize)
-	p.indcpaEncrypt(cmp, buf[:SymSize], sk.PublicKey.pk, kr[SymSize:]) // coins are in kr[SymSize:]
+	return nil
+}
+
+// KEMDecryptExplicit generates shared secret for given cipher text via the
+// explicit-rejection variant of the Kyber key encapsulation mechanism.  On
+// success, the shared secret is identical to that returned by KEMDecrypt,
+// but if the cipher text fails the re-encryption check,
+// ErrDecapsulationFailure is returned instead of a pseudorandom value.
+//
+// WARNING: Explicit rejection has different (weaker) security properties
+// than the implicit rejection used by KEMDecrypt, as it tells the caller
+// (and anyone who can observe the caller's behavior) whether decapsulation
+// failed.  This is ONLY intended for analysis, and for protocols that are
+// proven to not require implicit rejection.
+func (sk *PrivateKey) KEMDecryptExplicit(cipherText []byte) (sharedSecret []byte, err error) {
+	if len(cipherText) != sk.PublicKey.p.CipherTextSize() {
+		return nil, ErrInvalidCipherTextSize
+	}
 
-	hc := sha3.Sum256(cipherText)
+	kr, fail := sk.reencrypt(cipherText)
+	defer zeroize(kr[:])
+	recordDecapsulationRejection(fail)
+	if fail != 0 {
+		return nil, ErrDecapsulationFailure
+	}
+
+	hc := sum256(cipherText)
 	copy(kr[SymSize:], hc[:]) // overwrite coins in kr with H(c)
+	ss := sum256(kr[:])
+
+	return ss[:], nil
+}
 
-	fail := subtle.ConstantTimeSelect(subtle.ConstantTimeCompare(cipherText, cmp), 0, 1)
-	subtle.ConstantTimeCopy(fail, kr[SymSize:], sk.z) // Overwrite pre-k with z on re-encryption failure
+// WouldAccept returns true iff the cipher text passes the re-encryption
+// check performed by KEMDecrypt, ie: it was encapsulated to this PrivateKey
+// and was not corrupted in transit.
+//
+// WARNING: This reveals whether decapsulation would fail, which implicit
+// rejection exists to hide.  It MUST NOT be used in adversarial contexts,
+// and is only intended for diagnosing misrouted cipher texts in trusted
+// deployments.
+func (sk *PrivateKey) WouldAccept(cipherText []byte) bool {
+	if len(cipherText) != sk.PublicKey.p.CipherTextSize() {
+		return false
+	}
 
-	h := sha3.New256()
-	h.Write(kr[:])
-	sharedSecret = h.Sum(nil)
+	kr, fail := sk.reencrypt(cipherText)
+	zeroize(kr[:])
+
+	return fail == 0
+}
+
+// CipherTextEqual returns true iff a and b are both valid size cipher texts
+// for the ParameterSet, and are equal.  The comparison is done in constant
+// time (the lengths are considered public), and SHOULD be used instead of
+// bytes.Equal when cipher text equality may depend on secret data.
+func (p *ParameterSet) CipherTextEqual(a, b []byte) bool {
+	if len(a) != p.cipherTextSize || len(b) != p.cipherTextSize {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// decapsulationRejections is the number of decapsulations that failed the
+// re-encryption check, across all private keys.
+var decapsulationRejections uint64
+
+// DecapsulationRejectionCount returns the total number of decapsulations
+// (across all private keys, and all of the KEMDecrypt variants) that failed
+// the re-encryption check, ie: were implicitly (or explicitly) rejected,
+// since the process started.  A sudden increase in the rate of rejections
+// may indicate a chosen cipher text attack in progress.
+//
+// The count is maintained by unconditionally adding the (0 or 1) failure
+// bit to an atomic counter on every decapsulation, so maintaining it does
+// not add a data dependent branch or memory access.  However, as with any
+// aggregate, an adversary that can both submit cipher texts and observe the
+// count at a fine granularity (eg: immediately before and after each of
+// their own decapsulations) learns whether each was rejected, defeating
+// implicit rejection.  The count MUST only be exposed to trusted monitoring.
+func DecapsulationRejectionCount() uint64 {
+	return atomic.LoadUint64(&decapsulationRejections)
+}
+
+func recordDecapsulationRejection(fail int) {
+	atomic.AddUint64(&decapsulationRejections, uint64(fail))
+}
+
+// reencrypt decrypts the cipher text, and re-encrypts the result, returning
+// (pre-k || coins) and 1 iff the re-encrypted cipher text does not match.
+func (sk *PrivateKey) reencrypt(cipherText []byte) (kr [2 * SymSize]byte, fail int) {
+	var buf [2 * SymSize]byte
+
+	p := sk.PublicKey.p
+	s := p.getScratch()
+	defer p.putScratch(s)
+
+	p.indcpaDecrypt(buf[:SymSize], cipherText, sk.sk, s)
+
+	h := sk.PublicKey.hash()
+	copy(buf[SymSize:], h[:]) // Multitarget countermeasure for coins + contributory KEM
+	kr = sum512(buf[:])
+
+	cmp := s.cmp
+	if err := p.indcpaEncrypt(cmp, buf[:SymSize], sk.PublicKey.pk, kr[SymSize:], s); err != nil { // coins are in kr[SymSize:]
+		// The matrix only depends on the public seed, so this leaks
+		// nothing, and can not happen for an honestly generated key.
+		return kr, 1
+	}
+
+	fail = subtle.ConstantTimeSelect(subtle.ConstantTimeCompare(cipherText, cmp), 0, 1)
 
 	return
 }
+
+// CombineSecrets derives a SharedSecretSize byte hybrid shared secret from a
+// Kyber shared secret and cipher text, and the shared secret and peer public
+// key of a caller provided classical key exchange (eg: X25519, P-256).
+//
+// The output is the first SharedSecretSize bytes of:
+//
+//	SHAKE-256(kyberSS || classicalSS || kyberCT || classicalPub)
+//
+// No length prefixes are included, so the classical algorithm MUST be fixed
+// by the protocol.
+func CombineSecrets(kyberSS, classicalSS, kyberCT, classicalPub []byte) []byte {
+	xof := hashImpl.NewShake256()
+	xof.Write(kyberSS)
+	xof.Write(classicalSS)
+	xof.Write(kyberCT)
+	xof.Write(classicalPub)
+
+	ss := make([]byte, SharedSecretSize)
+	xof.Read(ss)
+
+	return ss
+}
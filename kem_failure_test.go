@@ -0,0 +1,85 @@
+// kem_failure_test.go - Kyber KEM decapsulation failure rate test.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// +build failurerate
+
+package kyber
+
+import (
+	"bytes"
+	"crypto/rand"
+	"flag"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var failureTrials = flag.Int("failure-trials", 1<<20, "number of encapsulations per parameter set for TestDecapsulationFailureRate")
+
+// TestDecapsulationFailureRate runs a large number of honest
+// encapsulate/decapsulate pairs, and counts the mismatches.  This takes a
+// long time, and is only built with `-tags failurerate`, eg:
+//
+//   go test -tags failurerate -run DecapsulationFailureRate -timeout 0
+//
+// The theoretical failure rate of every parameter set is below 2^-140, so
+// observing even a single failure in a feasible number of trials indicates
+// a gross bug rather than bad luck.  This will not catch a subtle increase
+// in the failure rate.
+func TestDecapsulationFailureRate(t *testing.T) {
+	for _, p := range allParams {
+		t.Run(p.Name(), func(t *testing.T) { doTestDecapsulationFailureRate(t, p) })
+	}
+}
+
+func doTestDecapsulationFailureRate(t *testing.T, p *ParameterSet) {
+	require := require.New(t)
+
+	nWorkers := runtime.GOMAXPROCS(0)
+	trialsPerWorker := (*failureTrials + nWorkers - 1) / nWorkers
+
+	var wg sync.WaitGroup
+	var nFailures uint64
+	errCh := make(chan error, nWorkers)
+	for i := 0; i < nWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Use a fresh key pair per worker, so that the trial covers
+			// more than one key.
+			pk, sk, err := p.GenerateKeyPair(rand.Reader)
+			if err != nil {
+				errCh <- err
+				return
+			}
+			for j := 0; j < trialsPerWorker; j++ {
+				ct, ss, err := pk.KEMEncrypt(rand.Reader)
+				if err != nil {
+					errCh <- err
+					return
+				}
+				if !bytes.Equal(ss, sk.KEMDecrypt(ct)) {
+					atomic.AddUint64(&nFailures, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		require.NoError(err, "KEMEncrypt()")
+	}
+
+	nTrials := trialsPerWorker * nWorkers
+	t.Logf("%d/%d failures (observed rate: %g)", nFailures, nTrials, float64(nFailures)/float64(nTrials))
+	require.Zero(nFailures, "Decapsulation failure rate grossly exceeds theoretical")
+}
@@ -0,0 +1,114 @@
+// kem_interop_test.go - Kyber KEM cross-implementation interop vectors.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const nrInteropVectors = 8
+
+var updateInterop = flag.Bool("update", false, "regenerate testdata/interop-*.json")
+
+// interopVectors is the JSON interop vector format.  Each vector's key pair
+// and encapsulation use the RNG output of newInteropRng(index), and byte
+// strings are base64 encoded (RFC 4648, with padding).
+type interopVectors struct {
+	ParameterSet string          `json:"parameterSet"`
+	Vectors      []interopVector `json:"vectors"`
+}
+
+type interopVector struct {
+	Index      uint64 `json:"index"`
+	PublicKey  []byte `json:"pk"`
+	PrivateKey []byte `json:"sk"`
+	CipherText []byte `json:"ct"`
+	SharedKey  []byte `json:"ss"`
+}
+
+// newInteropRng returns SHAKE-256("Kyber-Interop" || uint64_be(index)), which
+// is trivial to reproduce in other languages.
+func newInteropRng(index uint64) io.Reader {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], index)
+
+	xof := hashImpl.NewShake256()
+	xof.Write([]byte("Kyber-Interop"))
+	xof.Write(b[:])
+	return xof
+}
+
+func interopVectorsPath(p *ParameterSet) string {
+	return filepath.Join("testdata", "interop-"+p.Name()+".json")
+}
+
+func genInteropVectors(require *require.Assertions, p *ParameterSet) *interopVectors {
+	vecs := &interopVectors{ParameterSet: p.Name()}
+	for idx := uint64(0); idx < nrInteropVectors; idx++ {
+		rng := newInteropRng(idx)
+		pk, sk, err := p.GenerateKeyPair(rng)
+		require.NoError(err, "GenerateKeyPair(): %v", idx)
+		ct, ss, err := pk.KEMEncrypt(rng)
+		require.NoError(err, "KEMEncrypt(): %v", idx)
+
+		vecs.Vectors = append(vecs.Vectors, interopVector{
+			Index:      idx,
+			PublicKey:  pk.Bytes(),
+			PrivateKey: sk.Bytes(),
+			CipherText: ct,
+			SharedKey:  ss,
+		})
+	}
+	return vecs
+}
+
+func TestKEMInteropVectors(t *testing.T) {
+	for _, p := range allParams {
+		t.Run(p.Name(), func(t *testing.T) { doTestKEMInteropVectors(t, p) })
+	}
+}
+
+func doTestKEMInteropVectors(t *testing.T, p *ParameterSet) {
+	require := require.New(t)
+
+	vecs := genInteropVectors(require, p)
+	if *updateInterop {
+		b, err := json.MarshalIndent(vecs, "", "\t")
+		require.NoError(err, "json.MarshalIndent()")
+		require.NoError(ioutil.WriteFile(interopVectorsPath(p), append(b, '\n'), 0644), "WriteFile()")
+	}
+
+	b, err := ioutil.ReadFile(interopVectorsPath(p))
+	require.NoError(err, "ReadFile()")
+	var expected interopVectors
+	require.NoError(json.Unmarshal(b, &expected), "json.Unmarshal()")
+	require.Equal(p.Name(), expected.ParameterSet, "ParameterSet")
+	require.Len(expected.Vectors, nrInteropVectors, "Vectors")
+
+	for i, vec := range expected.Vectors {
+		// The imported values must be usable as is, as they would be by a
+		// different implementation.
+		pk, err := p.PublicKeyFromBytes(vec.PublicKey)
+		require.NoError(err, "PublicKeyFromBytes(): %v", vec.Index)
+		sk, err := p.PrivateKeyFromBytes(vec.PrivateKey)
+		require.NoError(err, "PrivateKeyFromBytes(): %v", vec.Index)
+		requirePublicKeyEqual(require, pk, &sk.PublicKey)
+		require.Equal(vec.SharedKey, sk.KEMDecrypt(vec.CipherText), "KEMDecrypt(): %v", vec.Index)
+
+		// And this implementation must reproduce them exactly.
+		require.Equal(vecs.Vectors[i], vec, "Vector: %v", vec.Index)
+	}
+}
@@ -10,9 +10,15 @@ package kyber
 import (
 	"bytes"
 	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/sha3"
 )
 
 const nTests = 100
@@ -50,6 +56,7 @@ func doTestKEM(t *testing.T) {
 	impl := "_" + hardwareAccelImpl.name
 	for _, p := range allParams {
 		t.Run(p.Name()+"_Keys"+impl, func(t *testing.T) { doTestKEMKeys(t, p) })
+		t.Run(p.Name()+"_RandomSize"+impl, func(t *testing.T) { doTestKEMRandomSize(t, p) })
 		t.Run(p.Name()+"_Invalid_SecretKey_A"+impl, func(t *testing.T) { doTestKEMInvalidSkA(t, p) })
 		t.Run(p.Name()+"_Invalid_CipherText"+impl, func(t *testing.T) { doTestKEMInvalidCipherText(t, p) })
 	}
@@ -62,6 +69,14 @@ func doTestKEMKeys(t *testing.T, p *ParameterSet) {
 	t.Logf("PublicKeySize(): %v", p.PublicKeySize())
 	t.Logf("CipherTextSize(): %v", p.CipherTextSize())
 
+	require.Equal(p.CipherTextSize()+32, p.HybridCipherTextSize(), "HybridCipherTextSize()")
+	require.Equal(p.CipherTextSize()+12+16, p.SealOverhead(), "SealOverhead()")
+
+	du, dv := p.CiphertextCompressionBits()
+	require.Equal(11, du, "CiphertextCompressionBits(): du")
+	require.Equal(3, dv, "CiphertextCompressionBits(): dv")
+	require.Equal((p.k*du+dv)*kyberN/8, p.CipherTextSize(), "CipherTextSize(): Compression")
+
 	for i := 0; i < nTests; i++ {
 		// Generate a key pair.
 		pk, sk, err := p.GenerateKeyPair(rand.Reader)
@@ -74,23 +89,610 @@ func doTestKEMKeys(t *testing.T, p *ParameterSet) {
 		require.NoError(err, "PrivateKeyFromBytes(b)")
 		requirePrivateKeyEqual(require, sk, sk2)
 
+		pkCopy := sk.PublicKeyCopy()
+		requirePublicKeyEqual(require, pk, pkCopy)
+		pkCopy.pk.packed[0] ^= 0xff
+		require.NotEqual(pk.Bytes(), pkCopy.Bytes(), "PublicKeyCopy(): Aliases sk")
+
 		b = pk.Bytes()
 		require.Len(b, p.PublicKeySize(), "pk.Bytes(): Length")
 		pk2, err := p.PublicKeyFromBytes(b)
 		require.NoError(err, "PublicKeyFromBytes(b)")
 		requirePublicKeyEqual(require, pk, pk2)
 
+		// Test serialization without the matrix seed.
+		body := pk.BytesWithoutSeed()
+		require.Len(body, p.PublicKeySize()-SymSize, "pk.BytesWithoutSeed(): Length")
+		pk2, err = p.PublicKeyFromBytesWithSeed(body, b[len(body):])
+		require.NoError(err, "PublicKeyFromBytesWithSeed(body, seed)")
+		requirePublicKeyEqual(require, pk, pk2)
+		_, err = p.PublicKeyFromBytesWithSeed(body[1:], b[len(body):])
+		require.Equal(ErrInvalidKeySize, err, "PublicKeyFromBytesWithSeed(short body, seed)")
+
+		// The body must not alias the PublicKey.
+		pkBytes := append([]byte{}, pk.Bytes()...)
+		ctBody, ssBody, err := pk.KEMEncrypt(NewSHAKEReader(pkBytes))
+		require.NoError(err, "KEMEncrypt()")
+		for i := range body {
+			body[i] ^= 0xff
+		}
+		_ = append(body, make([]byte, SymSize)...) // Would clobber the seed.
+		require.Equal(pkBytes, pk.Bytes(), "pk.BytesWithoutSeed(): Aliases pk")
+		ctBody2, ssBody2, err := pk.KEMEncrypt(NewSHAKEReader(pkBytes))
+		require.NoError(err, "KEMEncrypt(): After modifying body")
+		require.Equal(ctBody, ctBody2, "KEMEncrypt(): ct changed by modifying body")
+		require.Equal(ssBody, ssBody2, "KEMEncrypt(): ss changed by modifying body")
+
+		// An all-zero z must be rejected.
+		skZeroZ := append([]byte{}, sk.Bytes()...)
+		zeroize(skZeroZ[len(skZeroZ)-SymSize:])
+		_, err = p.PrivateKeyFromBytes(skZeroZ)
+		require.Equal(ErrInvalidZComponent, err, "PrivateKeyFromBytes(): All-zero z")
+
+		// Test commitments.
+		salt := []byte("salt")
+		c := pk.Commitment(salt)
+		require.Len(c, SymSize, "pk.Commitment(): Length")
+		require.True(VerifyCommitment(c, salt, pk), "VerifyCommitment()")
+		require.False(VerifyCommitment(c, []byte("salt2"), pk), "VerifyCommitment(): Wrong salt")
+		require.False(VerifyCommitment(c[1:], salt, pk), "VerifyCommitment(): Truncated")
+		require.False(VerifyCommitment(c, salt, pkCopy), "VerifyCommitment(): Wrong key")
+
+		// Test fingerprint pinning.
+		fp := pk.Fingerprint()
+		require.Equal(sum256(b), fp, "pk.Fingerprint()")
+		pk2, err = p.PublicKeyFromBytesWithFingerprint(b, fp)
+		require.NoError(err, "PublicKeyFromBytesWithFingerprint()")
+		requirePublicKeyEqual(require, pk, pk2)
+		fp[0] ^= 0x01
+		_, err = p.PublicKeyFromBytesWithFingerprint(b, fp)
+		require.Equal(ErrFingerprintMismatch, err, "PublicKeyFromBytesWithFingerprint(): Mismatch")
+		_, err = p.PublicKeyFromBytesWithFingerprint(b[1:], fp)
+		require.Equal(ErrInvalidKeySize, err, "PublicKeyFromBytesWithFingerprint(): Short")
+
 		// Test encrypt/decrypt.
 		ct, ss, err := pk.KEMEncrypt(rand.Reader)
 		require.NoError(err, "KEMEncrypt()")
 		require.Len(ct, p.CipherTextSize(), "KEMEncrypt(): ct Length")
-		require.Len(ss, SymSize, "KEMEncrypt(): ss Length")
+		require.Len(ss, SharedSecretSize, "KEMEncrypt(): ss Length")
 
 		ss2 := sk.KEMDecrypt(ct)
 		require.Equal(ss, ss2, "KEMDecrypt(): ss")
+		require.True(sk.WouldAccept(ct), "WouldAccept()")
+		require.False(sk.WouldAccept(ct[1:]), "WouldAccept(): Short")
+
+		ss4, err := sk.KEMDecryptExplicit(ct)
+		require.NoError(err, "KEMDecryptExplicit()")
+		require.Equal(ss, ss4, "KEMDecryptExplicit(): ss")
+		_, err = sk.KEMDecryptExplicit(ct[1:])
+		require.Equal(ErrInvalidCipherTextSize, err, "KEMDecryptExplicit(): Short")
+
+		ss3 := make([]byte, SymSize)
+		require.NoError(sk.KEMDecryptInto(ss3, ct), "KEMDecryptInto()")
+		require.Equal(ss, ss3, "KEMDecryptInto(): ss")
+		require.Equal(ErrInvalidSharedSecretSize, sk.KEMDecryptInto(ss3[1:], ct), "KEMDecryptInto(): Short dst")
+		require.Equal(ErrInvalidCipherTextSize, sk.KEMDecryptInto(ss3, ct[1:]), "KEMDecryptInto(): Short ct")
+
+		ct, ssA, err := pk.KEMEncryptShared(rand.Reader)
+		require.NoError(err, "KEMEncryptShared()")
+		ssB := sk.KEMDecryptShared(ct)
+		require.True(ssA.Equal(ssB), "KEMDecryptShared(): ss")
+		require.Equal(ssA.Bytes(), sk.KEMDecrypt(ct), "SharedSecret.Bytes()")
+		ssB[i%SymSize] ^= 0x01
+		require.False(ssA.Equal(ssB), "SharedSecret.Equal(): Corrupted")
+
+		e, err := pk.Encapsulate(rand.Reader)
+		require.NoError(err, "Encapsulate()")
+		require.Len(e.CipherText, p.CipherTextSize(), "Encapsulate(): ct Length")
+		require.True(e.SharedSecret.Equal(sk.KEMDecryptShared(e.CipherText)), "KEMDecryptShared(): ss")
+		e.Zeroize()
+		require.Equal(&SharedSecret{}, e.SharedSecret, "Encapsulation.Zeroize()")
+
+		// Test the legacy variant without H(c).
+		ct, ss, err = pk.KEMEncryptNoCTHash(rand.Reader)
+		require.NoError(err, "KEMEncryptNoCTHash()")
+		require.Len(ct, p.CipherTextSize(), "KEMEncryptNoCTHash(): ct Length")
+		require.Equal(ss, sk.KEMDecryptNoCTHash(ct), "KEMDecryptNoCTHash(): ss")
+		require.NotEqual(ss, sk.KEMDecrypt(ct), "KEMDecrypt(): NoCTHash ss")
+		ct[i%len(ct)] ^= 0x01
+		rej := sk.KEMDecryptNoCTHash(ct)
+		require.NotEqual(ss, rej, "KEMDecryptNoCTHash(): Corrupted ct")
+
+		// The rejection value must depend on the cipher text.
+		ct[(i+1)%len(ct)] ^= 0x01
+		require.NotEqual(rej, sk.KEMDecryptNoCTHash(ct), "KEMDecryptNoCTHash(): Rejection depends on ct")
+	}
+}
+
+func TestGenerateSerializedKeyPair(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range allParams {
+		pkBytes, skBytes, err := p.GenerateSerializedKeyPair(rand.Reader)
+		require.NoError(err, "GenerateSerializedKeyPair(): %s", p.Name())
+		require.Len(pkBytes, p.PublicKeySize(), "GenerateSerializedKeyPair(): %s: pk Length", p.Name())
+		require.Len(skBytes, p.PrivateKeySize(), "GenerateSerializedKeyPair(): %s: sk Length", p.Name())
+
+		// The intermediate PrivateKey is zeroized, which must not affect
+		// the returned serialization.
+		pk, err := p.PublicKeyFromBytes(pkBytes)
+		require.NoError(err, "PublicKeyFromBytes(): %s", p.Name())
+		sk, err := p.PrivateKeyFromBytes(skBytes)
+		require.NoError(err, "PrivateKeyFromBytes(): %s", p.Name())
+		requirePublicKeyEqual(require, pk, &sk.PublicKey)
+		require.Equal(skBytes, sk.Bytes(), "PrivateKeyFromBytes(): %s: Round trip", p.Name())
+
+		seed := []byte("TestGenerateSerializedKeyPair")
+		pkBytes, skBytes, err = p.GenerateSerializedKeyPair(NewSHAKEReader(seed))
+		require.NoError(err, "GenerateSerializedKeyPair(): %s: Seeded", p.Name())
+		pk2, sk2, err := p.GenerateKeyPair(NewSHAKEReader(seed))
+		require.NoError(err, "GenerateKeyPair(): %s: Seeded", p.Name())
+		require.Equal(pk2.Bytes(), pkBytes, "GenerateSerializedKeyPair(): %s: pk", p.Name())
+		require.Equal(sk2.Bytes(), skBytes, "GenerateSerializedKeyPair(): %s: sk", p.Name())
+
+		ct, ss, err := pk.KEMEncrypt(rand.Reader)
+		require.NoError(err, "KEMEncrypt(): %s", p.Name())
+		require.Equal(ss, sk.KEMDecrypt(ct), "KEMDecrypt(): %s", p.Name())
+	}
+
+	_, _, err := Kyber768.GenerateSerializedKeyPair(nil)
+	require.Equal(ErrNilRandomSource, err, "GenerateSerializedKeyPair(nil)")
+}
+
+func TestPublicKeyFromBytesArbitrary(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range allParams {
+		random := make([]byte, p.PublicKeySize())
+		_, err := rand.Read(random)
+		require.NoError(err, "rand.Read()")
+
+		for _, b := range [][]byte{
+			random,
+			bytes.Repeat([]byte{0x00}, p.PublicKeySize()),
+			bytes.Repeat([]byte{0xff}, p.PublicKeySize()),
+		} {
+			// Any correctly sized input is a public key that can be
+			// encapsulated to, and serializes back to the same bytes.
+			pk, err := p.PublicKeyFromBytes(b)
+			require.NoError(err, "%s: PublicKeyFromBytes()", p.Name())
+			require.Equal(b, pk.Bytes(), "%s: Bytes()", p.Name())
+			_, _, err = pk.KEMEncrypt(rand.Reader)
+			require.NoError(err, "%s: KEMEncrypt()", p.Name())
+		}
+
+		_, err = p.PublicKeyFromBytes(random[1:])
+		require.Equal(ErrInvalidKeySize, err, "%s: PublicKeyFromBytes(): Short", p.Name())
+	}
+}
+
+func TestPrivateKeyBytesRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range allParams {
+		_, sk, err := p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "%s: GenerateKeyPair()", p.Name())
+
+		b := sk.Bytes()
+		sk2, err := p.PrivateKeyFromBytes(b)
+		require.NoError(err, "%s: PrivateKeyFromBytes()", p.Name())
+		b2 := sk2.Bytes()
+		require.True(bytes.Equal(b, b2), "%s: Bytes(): Round trip", p.Name())
+
+		// Check each segment explicitly, so that an offset error is
+		// attributed to the correct field.
+		off := p.indcpaSecretKeySize
+		require.Equal(b[:off], b2[:off], "%s: Bytes(): IND-CPA sk", p.Name())
+		require.Equal(b[off:off+p.publicKeySize], b2[off:off+p.publicKeySize], "%s: Bytes(): pk", p.Name())
+		off += p.publicKeySize
+		require.Equal(sk.PublicKey.hc.h[:], b2[off:off+SymSize], "%s: Bytes(): H(pk)", p.Name())
+		off += SymSize
+		require.Equal(sk.z, b2[off:], "%s: Bytes(): z", p.Name())
+		require.Equal(p.PrivateKeySize(), off+SymSize, "%s: Bytes(): Length", p.Name())
+	}
+}
+
+func TestPrivateKeyFromBytesCorrupted(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range allParams {
+		_, sk, err := p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "%s: GenerateKeyPair()", p.Name())
+		b := sk.Bytes()
+
+		pkOff := p.indcpaSecretKeySize
+		hOff := pkOff + p.publicKeySize
+		zOff := hOff + SymSize
+		for _, v := range []struct {
+			name    string
+			corrupt func([]byte)
+			err     error
+		}{
+			// Set a 13 bit coefficient to 8191 (>= q).
+			{"IND-CPA sk: First", func(b []byte) { b[0], b[1] = 0xff, b[1]|0x1f }, ErrInvalidSecretKeyComponent},
+			{"IND-CPA sk: Last", func(b []byte) { b[pkOff-1] = 0xff }, ErrInvalidSecretKeyComponent},
+			// Every public key encoding parses, so corruption is caught
+			// by the H(pk) check.
+			{"pk: First", func(b []byte) { b[pkOff] ^= 0x01 }, ErrPublicKeyHashMismatch},
+			{"pk: Seed", func(b []byte) { b[hOff-1] ^= 0x01 }, ErrPublicKeyHashMismatch},
+			{"H(pk)", func(b []byte) { b[hOff] ^= 0x01 }, ErrPublicKeyHashMismatch},
+			{"z", func(b []byte) { zeroize(b[zOff:]) }, ErrInvalidZComponent},
+		} {
+			corrupted := append([]byte{}, b...)
+			v.corrupt(corrupted)
+			_, err = p.PrivateKeyFromBytes(corrupted)
+			require.Equal(v.err, err, "%s: PrivateKeyFromBytes(): Corrupted %s", p.Name(), v.name)
+			require.True(errors.Is(err, ErrInvalidPrivateKey), "%s: PrivateKeyFromBytes(): Corrupted %s: errors.Is()", p.Name(), v.name)
+		}
+
+		// The public key errors are distinguishable from the others, and
+		// never mistaken for a size error.
+		require.True(errors.Is(ErrPublicKeyHashMismatch, ErrInvalidPublicKeyComponent), "ErrPublicKeyHashMismatch: errors.Is(ErrInvalidPublicKeyComponent)")
+		for _, err := range []error{ErrInvalidSecretKeyComponent, ErrInvalidPublicKeyComponent, ErrPublicKeyHashMismatch, ErrInvalidZComponent} {
+			require.False(errors.Is(err, ErrInvalidKeySize), "%v: errors.Is(ErrInvalidKeySize)", err)
+		}
+		require.False(errors.Is(ErrInvalidZComponent, ErrInvalidPublicKeyComponent), "ErrInvalidZComponent: errors.Is(ErrInvalidPublicKeyComponent)")
+		require.False(errors.Is(ErrInvalidSecretKeyComponent, ErrInvalidPublicKeyComponent), "ErrInvalidSecretKeyComponent: errors.Is(ErrInvalidPublicKeyComponent)")
+
+		_, err = p.PrivateKeyFromBytes(b[:len(b)-1])
+		require.Equal(ErrInvalidKeySize, err, "%s: PrivateKeyFromBytes(): Truncated", p.Name())
 	}
 }
 
+func TestPublicKeyLazyHash(t *testing.T) {
+	require := require.New(t)
+
+	seed := []byte("TestPublicKeyLazyHash")
+	for _, p := range allParams {
+		pk, sk, err := p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "%s: GenerateKeyPair()", p.Name())
+		expected := sha3.Sum256(pk.Bytes())
+		ct, ss, err := pk.KEMEncrypt(NewSHAKEReader(seed))
+		require.NoError(err, "%s: KEMEncrypt()", p.Name())
+		require.Equal(ss, sk.KEMDecrypt(ct), "%s: KEMDecrypt()", p.Name())
+
+		// Encapsulation must be identical whether it is the first use of
+		// H(pk) or not, and with a freshly deserialized key.
+		for _, fingerprintFirst := range []bool{false, true} {
+			pk2, err := p.PublicKeyFromBytes(pk.Bytes())
+			require.NoError(err, "%s: PublicKeyFromBytes()", p.Name())
+			if fingerprintFirst {
+				require.Equal(expected, pk2.Fingerprint(), "%s: Fingerprint(): Before KEMEncrypt()", p.Name())
+			}
+			for i := 0; i < 2; i++ {
+				ct2, ss2, err := pk2.KEMEncrypt(NewSHAKEReader(seed))
+				require.NoError(err, "%s: KEMEncrypt(): %d", p.Name(), i)
+				require.Equal(ct, ct2, "%s: KEMEncrypt(): %d: ct", p.Name(), i)
+				require.Equal(ss, ss2, "%s: KEMEncrypt(): %d: ss", p.Name(), i)
+			}
+			require.Equal(expected, pk2.Fingerprint(), "%s: Fingerprint(): After KEMEncrypt()", p.Name())
+		}
+
+		// The first use may happen concurrently, run with `-race`.
+		pk3, err := p.PublicKeyFromBytes(pk.Bytes())
+		require.NoError(err, "%s: PublicKeyFromBytes()", p.Name())
+		const nWorkers = 8
+		var wg sync.WaitGroup
+		fingerprints := make([][SymSize]byte, nWorkers)
+		cts, sss := make([][]byte, nWorkers), make([][]byte, nWorkers)
+		for i := 0; i < nWorkers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if i%2 == 0 {
+					fingerprints[i] = pk3.Fingerprint()
+				}
+				cts[i], sss[i], _ = pk3.KEMEncrypt(NewSHAKEReader(seed))
+				if i%2 != 0 {
+					fingerprints[i] = pk3.Fingerprint()
+				}
+			}(i)
+		}
+		wg.Wait()
+		for i := 0; i < nWorkers; i++ {
+			require.Equal(expected, fingerprints[i], "%s: Concurrent Fingerprint(): %d", p.Name(), i)
+			require.Equal(ct, cts[i], "%s: Concurrent KEMEncrypt(): %d: ct", p.Name(), i)
+			require.Equal(ss, sss[i], "%s: Concurrent KEMEncrypt(): %d: ss", p.Name(), i)
+		}
+	}
+}
+
+func TestCipherTextEqual(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range allParams {
+		pk, _, err := p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "%s: GenerateKeyPair()", p.Name())
+		ct, _, err := pk.KEMEncrypt(rand.Reader)
+		require.NoError(err, "%s: KEMEncrypt()", p.Name())
+		ct2, _, err := pk.KEMEncrypt(rand.Reader)
+		require.NoError(err, "%s: KEMEncrypt()", p.Name())
+
+		require.True(p.CipherTextEqual(ct, append([]byte{}, ct...)), "%s: CipherTextEqual(): Equal", p.Name())
+		require.False(p.CipherTextEqual(ct, ct2), "%s: CipherTextEqual(): Different", p.Name())
+
+		corrupted := append([]byte{}, ct...)
+		corrupted[len(corrupted)-1] ^= 0x01
+		require.False(p.CipherTextEqual(ct, corrupted), "%s: CipherTextEqual(): Corrupted", p.Name())
+
+		// Correctly sized cipher texts are required, even if equal.
+		require.False(p.CipherTextEqual(ct[1:], ct[1:]), "%s: CipherTextEqual(): Short", p.Name())
+		require.False(p.CipherTextEqual(nil, nil), "%s: CipherTextEqual(): nil", p.Name())
+		other := Kyber512
+		if p == Kyber512 {
+			other = Kyber768
+		}
+		require.False(other.CipherTextEqual(ct, ct), "%s: CipherTextEqual(): Mismatched ParameterSet", p.Name())
+	}
+}
+
+func TestKeyPairFromSeed(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range allParams {
+		seed := make([]byte, p.KeyGenRandomSize())
+		_, err := rand.Read(seed)
+		require.NoError(err, "%s: rand.Read()", p.Name())
+
+		pk, sk, err := p.KeyPairFromSeed(seed)
+		require.NoError(err, "%s: KeyPairFromSeed()", p.Name())
+		pk2, sk2, err := p.GenerateKeyPair(bytes.NewReader(seed))
+		require.NoError(err, "%s: GenerateKeyPair()", p.Name())
+		requirePublicKeyEqual(require, pk, pk2)
+		requirePrivateKeyEqual(require, sk, sk2)
+
+		ok, err := p.VerifyPublicKeyFromSeed(seed, pk)
+		require.NoError(err, "%s: VerifyPublicKeyFromSeed()", p.Name())
+		require.True(ok, "%s: VerifyPublicKeyFromSeed()", p.Name())
+
+		// A different seed must not verify.
+		seed[0] ^= 0x01
+		ok, err = p.VerifyPublicKeyFromSeed(seed, pk)
+		require.NoError(err, "%s: VerifyPublicKeyFromSeed(): Wrong seed", p.Name())
+		require.False(ok, "%s: VerifyPublicKeyFromSeed(): Wrong seed", p.Name())
+
+		_, _, err = p.KeyPairFromSeed(seed[1:])
+		require.Equal(ErrInvalidSeedSize, err, "%s: KeyPairFromSeed(): Short seed", p.Name())
+		_, err = p.VerifyPublicKeyFromSeed(seed[1:], pk)
+		require.Equal(ErrInvalidSeedSize, err, "%s: VerifyPublicKeyFromSeed(): Short seed", p.Name())
+	}
+
+	pk, _, err := Kyber512.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+	_, err = Kyber768.VerifyPublicKeyFromSeed(make([]byte, Kyber768.KeyGenRandomSize()), pk)
+	require.Equal(ErrParameterSetMismatch, err, "VerifyPublicKeyFromSeed(): Mismatched ParameterSet")
+}
+
+func TestDecapsulationRejectionCount(t *testing.T) {
+	require := require.New(t)
+
+	p := Kyber768
+	pk, sk, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+	ct, _, err := pk.KEMEncrypt(rand.Reader)
+	require.NoError(err, "KEMEncrypt()")
+
+	before := DecapsulationRejectionCount()
+	sk.KEMDecrypt(ct)
+	ct[0] ^= 0x01
+	sk.KEMDecrypt(ct)
+	sk.KEMDecryptNoCTHash(ct)
+	_, err = sk.KEMDecryptExplicit(ct)
+	require.Equal(ErrDecapsulationFailure, err, "KEMDecryptExplicit(): Corrupted")
+	require.Equal(uint64(3), DecapsulationRejectionCount()-before, "DecapsulationRejectionCount()")
+}
+
+func TestKEMPadded(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(Kyber1024.CipherTextSize(), MaxCipherTextSize, "MaxCipherTextSize")
+
+	for _, p := range allParams {
+		pk, sk, err := p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "%s: GenerateKeyPair()", p.Name())
+
+		rng := NewCountingReader(rand.Reader)
+		ct, ss, err := pk.KEMEncryptPadded(rng)
+		require.NoError(err, "%s: KEMEncryptPadded()", p.Name())
+		require.Len(ct, MaxCipherTextSize, "%s: KEMEncryptPadded(): ct Length", p.Name())
+		require.Equal(uint64(p.EncapsulationRandomSize()+MaxCipherTextSize-p.CipherTextSize()), rng.BytesRead(), "%s: KEMEncryptPadded(): Entropy", p.Name())
+
+		ss2, err := sk.KEMDecryptPadded(ct)
+		require.NoError(err, "%s: KEMDecryptPadded()", p.Name())
+		require.Equal(ss, ss2, "%s: KEMDecryptPadded(): ss", p.Name())
+		require.Equal(ss, sk.KEMDecrypt(ct[:p.CipherTextSize()]), "%s: KEMDecrypt(): Stripped", p.Name())
+
+		_, err = sk.KEMDecryptPadded(ct[1:])
+		require.Equal(ErrInvalidCipherTextSize, err, "%s: KEMDecryptPadded(): Short", p.Name())
+	}
+}
+
+func TestKEMEncryptHedged(t *testing.T) {
+	require := require.New(t)
+
+	p := Kyber768
+	pk, sk, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+
+	seedA := bytes.Repeat([]byte{0xa}, SymSize)
+	seedB := bytes.Repeat([]byte{0xb}, SymSize)
+	brokenRng := func() io.Reader { return bytes.NewReader(make([]byte, SymSize)) }
+
+	ctA, ssA, err := pk.KEMEncryptHedged(brokenRng(), seedA)
+	require.NoError(err, "KEMEncryptHedged()")
+	require.Equal(ssA, sk.KEMDecrypt(ctA), "KEMDecrypt(): Hedged")
+
+	// With a broken rng, the output must be determined by the static seed.
+	ctA2, _, err := pk.KEMEncryptHedged(brokenRng(), seedA)
+	require.NoError(err, "KEMEncryptHedged(): Same seed")
+	require.Equal(ctA, ctA2, "KEMEncryptHedged(): Same seed")
+	ctB, _, err := pk.KEMEncryptHedged(brokenRng(), seedB)
+	require.NoError(err, "KEMEncryptHedged(): Different seed")
+	require.NotEqual(ctA, ctB, "KEMEncryptHedged(): Different seed")
+	// Without hedging, the broken rng must be detected.
+	_, _, err = pk.KEMEncrypt(brokenRng())
+	require.Equal(ErrBrokenRandomness, err, "KEMEncrypt(): Broken rng")
+
+	_, _, err = pk.KEMEncryptHedged(rand.Reader, seedA[1:])
+	require.Equal(ErrInvalidSeedSize, err, "KEMEncryptHedged(): Short seed")
+	_, _, err = pk.KEMEncryptHedged(nil, seedA)
+	require.Equal(ErrNilRandomSource, err, "KEMEncryptHedged(nil)")
+}
+
+func TestKEMMultitargetCountermeasure(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range allParams {
+		pk, sk, err := p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "%s: GenerateKeyPair()", p.Name())
+
+		// A copy of the public key that differs only in H(pk).  Without the
+		// countermeasure, encapsulating the same message to both would
+		// yield identical cipher texts and shared secrets.
+		pkAlt := sk.PublicKeyCopy()
+		pkAlt.hc.h[0] ^= 0x01
+
+		var m [SymSize]byte
+		_, err = rand.Read(m[:])
+		require.NoError(err, "%s: rand.Read()", p.Name())
+
+		buf := m
+		ct, ss, err := pk.kemEncryptMessage(&buf, true, nil)
+		require.NoError(err, "%s: kemEncryptMessage()", p.Name())
+		buf = m
+		ct2, ss2, err := pk.kemEncryptMessage(&buf, true, nil)
+		require.NoError(err, "%s: kemEncryptMessage(): Again", p.Name())
+		require.Equal(ct, ct2, "%s: kemEncryptMessage(): Deterministic ct", p.Name())
+		require.Equal(ss, ss2, "%s: kemEncryptMessage(): Deterministic ss", p.Name())
+
+		buf = m
+		ctAlt, ssAlt, err := pkAlt.kemEncryptMessage(&buf, true, nil)
+		require.NoError(err, "%s: kemEncryptMessage(): Alt H(pk)", p.Name())
+		require.NotEqual(ct, ctAlt, "%s: Coins do not depend on H(pk)", p.Name())
+		require.NotEqual(ss, ssAlt, "%s: Shared secret does not depend on H(pk)", p.Name())
+
+		// Decapsulation must also mix in H(pk), so the re-encryption check
+		// fails when it does not match the one used for encapsulation.
+		require.Equal(ss, sk.KEMDecrypt(ct), "%s: KEMDecrypt()", p.Name())
+		require.False(sk.WouldAccept(ctAlt), "%s: WouldAccept(): Alt H(pk)", p.Name())
+	}
+}
+
+func TestNilRandomSource(t *testing.T) {
+	require := require.New(t)
+
+	p := Kyber768
+	_, _, err := p.GenerateKeyPair(nil)
+	require.Equal(ErrNilRandomSource, err, "GenerateKeyPair(nil)")
+
+	pk, sk, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+	_, _, err = pk.KEMEncrypt(nil)
+	require.Equal(ErrNilRandomSource, err, "KEMEncrypt(nil)")
+	_, _, err = pk.KEMEncryptNoCTHash(nil)
+	require.Equal(ErrNilRandomSource, err, "KEMEncryptNoCTHash(nil)")
+
+	_, err = pk.NewUAKEInitiatorState(nil)
+	require.Equal(ErrNilRandomSource, err, "NewUAKEInitiatorState(nil)")
+	_, err = pk.NewAKEInitiatorState(nil)
+	require.Equal(ErrNilRandomSource, err, "NewAKEInitiatorState(nil)")
+
+	msg := make([]byte, p.UAKEInitiatorMessageSize())
+	require.PanicsWithValue(ErrNilRandomSource, func() { p.UAKEResponderShared(nil, msg, sk) }, "UAKEResponderShared(nil)")
+	require.PanicsWithValue(ErrNilRandomSource, func() { p.AKEResponderShared(nil, msg, sk, pk) }, "AKEResponderShared(nil)")
+}
+
+func TestIsAllZero(t *testing.T) {
+	require := require.New(t)
+
+	b := make([]byte, SymSize)
+	require.True(isAllZero(b), "isAllZero(): Zero")
+	for i := range b {
+		b[i] = 0x80
+		require.False(isAllZero(b), "isAllZero(): Byte %d set", i)
+		b[i] = 0
+	}
+	require.True(isAllZero(nil), "isAllZero(): Empty")
+}
+
+type repeatedByteReader byte
+
+func (r repeatedByteReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+func TestBrokenRandomness(t *testing.T) {
+	require := require.New(t)
+
+	b := make([]byte, SymSize)
+	require.True(isRepeatedByte(b), "isRepeatedByte(): Zero")
+	for i := range b {
+		b[i] = 0x80
+		require.False(isRepeatedByte(b), "isRepeatedByte(): Byte %d differs", i)
+		b[i] = 0
+	}
+
+	pk, _, err := Kyber768.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+	for _, r := range []repeatedByteReader{0x00, 0xff} {
+		_, _, err = pk.KEMEncrypt(r)
+		require.Equal(ErrBrokenRandomness, err, "KEMEncrypt(): Stuck at %#02x", byte(r))
+		_, _, err = pk.KEMEncryptNoCTHash(r)
+		require.Equal(ErrBrokenRandomness, err, "KEMEncryptNoCTHash(): Stuck at %#02x", byte(r))
+	}
+}
+
+func TestCombineSecrets(t *testing.T) {
+	require := require.New(t)
+
+	var kyberSS, classicalSS, kyberCT, classicalPub [SymSize]byte
+	for _, b := range [][]byte{kyberSS[:], classicalSS[:], kyberCT[:], classicalPub[:]} {
+		_, err := rand.Read(b)
+		require.NoError(err, "rand.Read()")
+	}
+
+	ss := CombineSecrets(kyberSS[:], classicalSS[:], kyberCT[:], classicalPub[:])
+	require.Len(ss, SharedSecretSize, "CombineSecrets(): Length")
+
+	var b []byte
+	b = append(b, kyberSS[:]...)
+	b = append(b, classicalSS[:]...)
+	b = append(b, kyberCT[:]...)
+	b = append(b, classicalPub[:]...)
+	expected := make([]byte, SymSize)
+	shakeSum256(expected, b)
+	require.Equal(expected, ss, "CombineSecrets(): Concatenation order")
+
+	ss2 := CombineSecrets(classicalSS[:], kyberSS[:], kyberCT[:], classicalPub[:])
+	require.NotEqual(ss, ss2, "CombineSecrets(): Swapped secrets")
+}
+
+func doTestKEMRandomSize(t *testing.T, p *ParameterSet) {
+	require := require.New(t)
+
+	rng := newExactReader(require, p.KeyGenRandomSize())
+	pk, sk, err := p.GenerateKeyPair(rng)
+	require.NoError(err, "GenerateKeyPair()")
+	require.Zero(rng.Len(), "GenerateKeyPair(): Unused entropy")
+
+	rng = newExactReader(require, p.EncapsulationRandomSize())
+	ct, ss, err := pk.KEMEncrypt(rng)
+	require.NoError(err, "KEMEncrypt()")
+	require.Zero(rng.Len(), "KEMEncrypt(): Unused entropy")
+	require.Equal(ss, sk.KEMDecrypt(ct), "KEMDecrypt(): ss")
+}
+
+func newExactReader(require *require.Assertions, n int) *bytes.Reader {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	require.NoError(err, "rand.Read()")
+
+	return bytes.NewReader(b)
+}
+
 func doTestKEMInvalidSkA(t *testing.T, p *ParameterSet) {
 	require := require.New(t)
 
@@ -110,6 +712,9 @@ func doTestKEMInvalidSkA(t *testing.T, p *ParameterSet) {
 		// Alice uses Bob's response to get her secret key.
 		keyA := skA.KEMDecrypt(sendB)
 		require.NotEqual(keyA, keyB, "KEMDecrypt(): ss")
+		require.False(skA.WouldAccept(sendB), "WouldAccept(): Corrupted")
+		_, err = skA.KEMDecryptExplicit(sendB)
+		require.Equal(ErrDecapsulationFailure, err, "KEMDecryptExplicit(): Corrupted")
 	}
 }
 
@@ -138,6 +743,130 @@ func doTestKEMInvalidCipherText(t *testing.T, p *ParameterSet) {
 		// Alice uses Bob's response to get her secret key.
 		keyA := skA.KEMDecrypt(sendB)
 		require.NotEqual(keyA, keyB, "KEMDecrypt(): ss")
+		require.False(skA.WouldAccept(sendB), "WouldAccept(): Corrupted")
+	}
+}
+
+func TestKEMConcurrent(t *testing.T) {
+	const nWorkers = 8
+
+	require := require.New(t)
+
+	pk, sk, err := Kyber768.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+
+	// Hammer a single key pair from many goroutines, run with `-race`.
+	var wg sync.WaitGroup
+	errCh := make(chan error, nWorkers)
+	for i := 0; i < nWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < nTests/10; j++ {
+				ct, ss, err := pk.KEMEncrypt(rand.Reader)
+				if err != nil {
+					errCh <- err
+					return
+				}
+				if !bytes.Equal(ss, sk.KEMDecrypt(ct)) {
+					errCh <- errors.New("KEMDecrypt(): ss mismatch")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		require.NoError(err, "Concurrent KEMEncrypt()/KEMDecrypt()")
+	}
+}
+
+func TestKEMDecryptIntoAllocs(t *testing.T) {
+	if raceEnabled || traceEnabled {
+		t.Skip("allocation counts are not meaningful with -race or kybertrace")
+	}
+
+	require := require.New(t)
+
+	for _, p := range allParams {
+		pk, sk, err := p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "%s: GenerateKeyPair()", p.Name())
+		ct, _, err := pk.KEMEncrypt(rand.Reader)
+		require.NoError(err, "%s: KEMEncrypt()", p.Name())
+
+		require.Zero(kemDecryptIntoAllocs(sk, ct), "%s: KEMDecryptInto() allocs/op", p.Name())
+	}
+}
+
+func kemDecryptIntoAllocs(sk *PrivateKey, ct []byte) float64 {
+	dst := make([]byte, SharedSecretSize)
+	return testing.AllocsPerRun(100, func() {
+		sk.KEMDecryptInto(dst, ct)
+	})
+}
+
+func TestKEMConcurrentParameterSets(t *testing.T) {
+	const nWorkers = 4
+
+	require := require.New(t)
+
+	// Each ParameterSet has its own pool of scratch space, so interleave
+	// operations across all of them from many goroutines, and check that
+	// the (deterministic) output matches that of a sequential run, run with
+	// `-race`.
+	type job struct {
+		pk      *PublicKey
+		sk      *PrivateKey
+		pkBytes []byte
+		seed    []byte
+		ct      []byte
+		ss      []byte
+	}
+	var jobs []*job
+	for _, p := range allParams {
+		pk, sk, err := p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "%s: GenerateKeyPair()", p.Name())
+		for i := 0; i < nWorkers; i++ {
+			j := &job{pk: pk, sk: sk, pkBytes: pk.Bytes(), seed: []byte(fmt.Sprintf("%s-%d", p.Name(), i))}
+			j.ct, j.ss, err = pk.KEMEncrypt(NewSHAKEReader(j.seed))
+			require.NoError(err, "%s: KEMEncrypt()", p.Name())
+			jobs = append(jobs, j)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, len(jobs))
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			for i := 0; i < nTests/10; i++ {
+				ct, ss, err := j.pk.KEMEncrypt(NewSHAKEReader(j.seed))
+				if err != nil {
+					errCh <- err
+					return
+				}
+				if !bytes.Equal(ct, j.ct) || !bytes.Equal(ss, j.ss) {
+					errCh <- fmt.Errorf("%s: KEMEncrypt(): output mismatch", j.pk.p.Name())
+					return
+				}
+				if !bytes.Equal(j.sk.KEMDecrypt(ct), j.ss) {
+					errCh <- fmt.Errorf("%s: KEMDecrypt(): ss mismatch", j.pk.p.Name())
+					return
+				}
+			}
+		}(j)
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		require.NoError(err, "Concurrent KEMEncrypt()/KEMDecrypt()")
+	}
+	for _, j := range jobs {
+		require.Equal(j.pkBytes, j.pk.Bytes(), "%s: PublicKey modified by KEMEncrypt()", j.pk.p.Name())
 	}
 }
 
@@ -170,6 +899,7 @@ func doBenchmarkKEM(b *testing.B) {
 		b.Run(p.Name()+"_GenerateKeyPair"+impl, func(b *testing.B) { doBenchKEMGenerateKeyPair(b, p) })
 		b.Run(p.Name()+"_KEMEncrypt"+impl, func(b *testing.B) { doBenchKEMEncDec(b, p, true) })
 		b.Run(p.Name()+"_KEMDecrypt"+impl, func(b *testing.B) { doBenchKEMEncDec(b, p, false) })
+		b.Run(p.Name()+"_KEMDecryptInto"+impl, func(b *testing.B) { doBenchKEMDecryptInto(b, p) })
 	}
 }
 
@@ -215,6 +945,124 @@ func doBenchKEMEncDec(b *testing.B, p *ParameterSet, isEnc bool) {
 	}
 }
 
+func doBenchKEMDecryptInto(b *testing.B, p *ParameterSet) {
+	pk, sk, err := p.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		b.Fatalf("GenerateKeyPair(): %v", err)
+	}
+	ct, ss, err := pk.KEMEncrypt(rand.Reader)
+	if err != nil {
+		b.Fatalf("KEMEncrypt(): %v", err)
+	}
+
+	// Decapsulation reuses pooled scratch space, and should not allocate.
+	if n := kemDecryptIntoAllocs(sk, ct); n != 0 && !raceEnabled && !traceEnabled {
+		b.Fatalf("KEMDecryptInto(): %v allocs/op", n)
+	}
+
+	dst := make([]byte, SymSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err = sk.KEMDecryptInto(dst, ct); err != nil {
+			b.Fatalf("KEMDecryptInto(): %v", err)
+		}
+	}
+	b.StopTimer()
+
+	if !bytes.Equal(dst, ss) {
+		b.Fatalf("KEMDecryptInto(): key mismatch")
+	}
+}
+
+// BenchmarkPublicKeyFromBytes measures deserializing public keys, both
+// alone, and followed by Fingerprint (ie: parsing many keys, versus parsing
+// and identifying them).
+func BenchmarkPublicKeyFromBytes(b *testing.B) {
+	for _, p := range allParams {
+		pk, _, err := p.GenerateKeyPair(rand.Reader)
+		if err != nil {
+			b.Fatalf("GenerateKeyPair(): %v", err)
+		}
+		pkBytes := pk.Bytes()
+
+		for _, withFingerprint := range []bool{false, true} {
+			n := p.Name() + "_Parse"
+			if withFingerprint {
+				n += "_Fingerprint"
+			}
+			b.Run(n, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					pk, err := p.PublicKeyFromBytes(pkBytes)
+					if err != nil {
+						b.Fatalf("PublicKeyFromBytes(): %v", err)
+					}
+					if withFingerprint {
+						pk.Fingerprint()
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkKEMScaling measures the throughput of concurrent key generation
+// and decapsulation (with a shared PrivateKey) at various GOMAXPROCS, along
+// with the single-threaded loop baseline, to show the parallel efficiency on
+// the host.  As RunParallel reports the wall clock time per operation, the
+// throughput is the inverse of ns/op.
+func BenchmarkKEMScaling(b *testing.B) {
+	p := Kyber768
+	pk, sk, err := p.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		b.Fatalf("GenerateKeyPair(): %v", err)
+	}
+	ct, _, err := pk.KEMEncrypt(rand.Reader)
+	if err != nil {
+		b.Fatalf("KEMEncrypt(): %v", err)
+	}
+
+	ops := []struct {
+		name string
+		fn   func(dst []byte) error
+	}{
+		{"GenerateKeyPair", func([]byte) error {
+			_, _, err := p.GenerateKeyPair(rand.Reader)
+			return err
+		}},
+		{"KEMDecryptInto", func(dst []byte) error {
+			return sk.KEMDecryptInto(dst, ct)
+		}},
+	}
+
+	for _, op := range ops {
+		b.Run(op.name+"_Baseline", func(b *testing.B) {
+			dst := make([]byte, SymSize)
+			for i := 0; i < b.N; i++ {
+				if err := op.fn(dst); err != nil {
+					b.Fatalf("%s: %v", op.name, err)
+				}
+			}
+		})
+
+		for _, procs := range []int{1, 2, 4, 8} {
+			b.Run(fmt.Sprintf("%s_GOMAXPROCS=%d", op.name, procs), func(b *testing.B) {
+				defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+
+				b.RunParallel(func(pb *testing.PB) {
+					dst := make([]byte, SymSize)
+					for pb.Next() {
+						if err := op.fn(dst); err != nil {
+							b.Errorf("%s: %v", op.name, err)
+							return
+						}
+					}
+				})
+			})
+		}
+	}
+}
+
 func init() {
 	canAccelerate = IsHardwareAccelerated()
 }
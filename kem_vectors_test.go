@@ -13,9 +13,12 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"flag"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -23,7 +26,26 @@ import (
 
 const nrTestVectors = 1000 // WARNING: Must match the reference code.
 
-var compactTestVectors = make(map[string][]byte)
+var (
+	compactTestVectors = make(map[string][]byte)
+
+	vectorReport = flag.String("vector-report", "", "write a KEM test vector pass/fail report for every backend to this file")
+)
+
+// vectorReportResults is the JSON release qualification report format written by
+// TestKEMVectorsReport.
+type vectorReportResults struct {
+	GOOS      string               `json:"goos"`
+	GOARCH    string               `json:"goarch"`
+	GoVersion string               `json:"goVersion"`
+	Results   []vectorReportResult `json:"results"`
+}
+
+type vectorReportResult struct {
+	ParameterSet string `json:"parameterSet"`
+	Backend      string `json:"backend"`
+	Pass         bool   `json:"pass"`
+}
 
 func TestKEMVectors(t *testing.T) {
 	if err := loadCompactTestVectors(); err != nil {
@@ -41,6 +63,56 @@ func TestKEMVectors(t *testing.T) {
 	doTestKEMVectors(t)
 }
 
+// TestKEMVectorsReport runs the compact KEM test vectors for every parameter
+// set with every backend supported by the host, and writes the resulting
+// pass/fail matrix as JSON, so that it can be attached to a release as
+// qualification evidence.  It only runs when a report file is specified,
+// eg:
+//
+//   go test -run KEMVectorsReport -vector-report qualification.json
+//
+// The report is written even if some of the combinations fail.
+func TestKEMVectorsReport(t *testing.T) {
+	if *vectorReport == "" {
+		t.Skip("No -vector-report file specified.")
+	}
+
+	if err := loadCompactTestVectors(); err != nil {
+		t.Fatalf("loadCompactTestVectors(): %v", err)
+	}
+
+	oldImpl, oldAccel := hardwareAccelImpl, isHardwareAccelerated
+	defer func() {
+		hardwareAccelImpl, isHardwareAccelerated = oldImpl, oldAccel
+	}()
+
+	report := &vectorReportResults{
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		GoVersion: runtime.Version(),
+	}
+	for _, impl := range supportedHardwareAccelImpls() {
+		hardwareAccelImpl = impl
+		isHardwareAccelerated = impl != implReference
+
+		for _, p := range allParams {
+			ok := t.Run(p.Name()+"_"+impl.name, func(t *testing.T) {
+				doTestKEMVectorsCompact(require.New(t), p)
+			})
+			report.Results = append(report.Results, vectorReportResult{
+				ParameterSet: p.Name(),
+				Backend:      impl.name,
+				Pass:         ok,
+			})
+		}
+	}
+
+	require := require.New(t)
+	b, err := json.MarshalIndent(report, "", "\t")
+	require.NoError(err, "json.MarshalIndent()")
+	require.NoError(ioutil.WriteFile(*vectorReport, append(b, '\n'), 0644), "WriteFile()")
+}
+
 func doTestKEMVectors(t *testing.T) {
 	impl := "_" + hardwareAccelImpl.name
 	for _, p := range allParams {
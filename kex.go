@@ -8,10 +8,10 @@
 package kyber
 
 import (
+	"crypto/subtle"
+	"encoding/binary"
 	"errors"
 	"io"
-
-	"golang.org/x/crypto/sha3"
 )
 
 var (
@@ -22,8 +22,140 @@ var (
 	// ErrParameterSetMismatch is the error thrown via a panic when there
 	// is a mismatch between parameter sets.
 	ErrParameterSetMismatch = errors.New("kyber: parameter set mismatch")
+
+	// ErrStateReused is the error thrown via a panic when a initiator
+	// state is used for more than one key exchange.
+	ErrStateReused = errors.New("kyber: initiator state reused")
 )
 
+// MaxExpandedSize is the maximum output size of ExpandSharedSecret in bytes.
+const MaxExpandedSize = 1 << 20
+
+var (
+	// ErrInvalidLength is the error returned when a requested output
+	// length is zero or exceeds MaxExpandedSize.
+	ErrInvalidLength = errors.New("kyber: invalid output length")
+
+	// ErrInvalidLabels is the error returned when the sub-key labels passed
+	// to DeriveKeys are missing, duplicated, or do not match the lengths.
+	ErrInvalidLabels = errors.New("kyber: invalid sub-key labels")
+
+	sessionIDDomainSep        = []byte("Kyber-SessionID")
+	expandDomainSep           = []byte("Kyber-Expand")
+	confirmInitiatorDomainSep = []byte("Kyber-KeyConfirmation-Initiator")
+	confirmResponderDomainSep = []byte("Kyber-KeyConfirmation-Responder")
+	deriveKeysDomainSep       = []byte("Kyber-DeriveKeys")
+)
+
+// KEXInitiatorMessageSize returns the size of the initiator KEX message
+// in bytes.
+func (p *ParameterSet) KEXInitiatorMessageSize() int {
+	return p.PublicKeySize()
+}
+
+// KEXResponderMessageSize returns the size of the responder KEX message
+// in bytes.
+func (p *ParameterSet) KEXResponderMessageSize() int {
+	return p.CipherTextSize()
+}
+
+// KEXInitiatorRandomSize returns the number of bytes of entropy consumed
+// from the io.Reader by NewKEXInitiatorState.
+func (p *ParameterSet) KEXInitiatorRandomSize() int {
+	return p.KeyGenRandomSize()
+}
+
+// KEXResponderRandomSize returns the number of bytes of entropy consumed
+// from the io.Reader by KEXResponderShared.
+func (p *ParameterSet) KEXResponderRandomSize() int {
+	return p.EncapsulationRandomSize()
+}
+
+// KEXInitiatorState is a initiator unauthenticated (ephemeral-ephemeral) key
+// exchange instance, analogous to ECDHE.  Each instance MUST only be used
+// for one key exchange and never reused.
+//
+// This is the KEM with an ephemeral key pair, and provides no
+// authentication, see the UAKE and AKE variants if that is required.
+type KEXInitiatorState struct {
+	// Message is the KEX message to send to the responder.
+	Message []byte
+
+	eSk  *PrivateKey
+	used bool
+}
+
+// Shared generates a shared secret for the given KEX instance and responder
+// message.
+//
+// On failures, sharedSecret will contain a randomized value.  Providing a
+// message that is obviously malformed (too large/small) will result in a
+// panic.
+//
+// Calling Shared more than once on the same instance will result in a panic.
+// A malformed message is rejected before the instance is marked as used, so
+// it does not count as a call.
+func (s *KEXInitiatorState) Shared(recv []byte) (sharedSecret []byte) {
+	if s.used {
+		panic(ErrStateReused)
+	}
+	if len(recv) != s.eSk.PublicKey.p.KEXResponderMessageSize() {
+		panic(ErrInvalidMessageSize)
+	}
+	s.used = true
+
+	return s.eSk.KEMDecrypt(recv)
+}
+
+// Zeroize overwrites the ephemeral private key and message of the KEX
+// instance with zeros, and marks it as used.  This SHOULD be called once the
+// key exchange has completed (or been abandoned).
+func (s *KEXInitiatorState) Zeroize() {
+	s.eSk.Zeroize()
+	zeroize(s.Message)
+	s.used = true
+}
+
+// NewKEXInitiatorState creates a new initiator KEX instance.
+func (p *ParameterSet) NewKEXInitiatorState(rng io.Reader) (*KEXInitiatorState, error) {
+	s := new(KEXInitiatorState)
+
+	var err error
+	_, s.eSk, err = p.GenerateKeyPair(rng)
+	if err != nil {
+		return nil, err
+	}
+	s.Message = append([]byte{}, s.eSk.PublicKey.Bytes()...)
+
+	return s, nil
+}
+
+// KEXResponderShared generates a responder message and shared secret given
+// a initiator KEX message.
+//
+// Providing a message that is obviously malformed (too large/small), or a
+// nil rng will result in a panic.
+func (p *ParameterSet) KEXResponderShared(rng io.Reader, recv []byte) (message, sharedSecret []byte) {
+	if rng == nil {
+		panic(ErrNilRandomSource)
+	}
+	if len(recv) != p.KEXInitiatorMessageSize() {
+		panic(ErrInvalidMessageSize)
+	}
+
+	// Deserialize the peer's ephemeral public key.
+	pk, err := p.PublicKeyFromBytes(recv)
+	if err != nil {
+		panic(err)
+	}
+
+	if message, sharedSecret, err = pk.KEMEncrypt(rng); err != nil {
+		panic(err)
+	}
+
+	return
+}
+
 // UAKEInitiatorMessageSize returns the size of the initiator UAKE message
 // in bytes.
 func (p *ParameterSet) UAKEInitiatorMessageSize() int {
@@ -36,48 +168,133 @@ func (p *ParameterSet) UAKEResponderMessageSize() int {
 	return p.CipherTextSize()
 }
 
+// UAKEInitiatorRandomSize returns the number of bytes of entropy consumed
+// from the io.Reader by NewUAKEInitiatorState.
+func (p *ParameterSet) UAKEInitiatorRandomSize() int {
+	return p.KeyGenRandomSize() + p.EncapsulationRandomSize()
+}
+
+// UAKEResponderRandomSize returns the number of bytes of entropy consumed
+// from the io.Reader by UAKEResponderShared.
+func (p *ParameterSet) UAKEResponderRandomSize() int {
+	return p.EncapsulationRandomSize()
+}
+
+// UAKEHandshakeSize returns the total size of the messages exchanged in a
+// UAKE handshake (initiator and responder) in bytes.
+func (p *ParameterSet) UAKEHandshakeSize() int {
+	return p.UAKEInitiatorMessageSize() + p.UAKEResponderMessageSize()
+}
+
 // UAKEInitiatorState is a initiator UAKE instance.  Each instance MUST only
 // be used for one key exchange and never reused.
 type UAKEInitiatorState struct {
 	// Message is the UAKE message to send to the responder.
 	Message []byte
 
-	eSk *PrivateKey
-	tk  []byte
+	eSk  *PrivateKey
+	tk   []byte
+	used bool
 }
 
 // Shared generates a shared secret for the given UAKE instance and responder
 // message.
 //
 // On failures, sharedSecret will contain a randomized value.  Providing a
-// cipher text that is obviously malformed (too large/small) will result in a
+// message that is obviously malformed (too large/small) will result in a
 // panic.
+//
+// Calling Shared more than once on the same instance will result in a panic.
+// A malformed message is rejected before the instance is marked as used, so
+// it does not count as a call.
 func (s *UAKEInitiatorState) Shared(recv []byte) (sharedSecret []byte) {
-	xof := sha3.NewShake256()
+	if s.used {
+		panic(ErrStateReused)
+	}
+	if len(recv) != s.eSk.PublicKey.p.UAKEResponderMessageSize() {
+		panic(ErrInvalidMessageSize)
+	}
+	s.used = true
+
+	xof := hashImpl.NewShake256()
 	var tk []byte
 
 	tk = s.eSk.KEMDecrypt(recv)
 	xof.Write(tk)
+	zeroize(tk)
 	xof.Write(s.tk)
-	sharedSecret = make([]byte, SymSize)
+	zeroize(s.tk)
+	sharedSecret = make([]byte, SharedSecretSize)
 	xof.Read(sharedSecret)
 
 	return
 }
 
+// Zeroize overwrites the ephemeral private key, the initiator's KEM shared
+// secret, and the message of the UAKE instance with zeros, and marks it as
+// used.  Shared only wipes the KEM shared secret, as the message may still
+// be required (eg: for a transcript), so this SHOULD be called once the
+// key exchange has completed (or been abandoned).
+func (s *UAKEInitiatorState) Zeroize() {
+	s.eSk.Zeroize()
+	zeroize(s.tk)
+	zeroize(s.Message)
+	s.used = true
+}
+
 // NewUAKEInitiatorState creates a new initiator UAKE instance.
 func (pk *PublicKey) NewUAKEInitiatorState(rng io.Reader) (*UAKEInitiatorState, error) {
-	s := new(UAKEInitiatorState)
-	s.Message = make([]byte, 0, pk.p.UAKEInitiatorMessageSize())
+	if rng == nil {
+		return nil, ErrNilRandomSource
+	}
 
-	var err error
-	_, s.eSk, err = pk.p.GenerateKeyPair(rng)
+	_, eSk, err := pk.p.GenerateKeyPair(rng)
 	if err != nil {
 		return nil, err
 	}
+
+	return pk.NewUAKEInitiatorStateWithEphemeral(eSk, rng)
+}
+
+// NewUAKEInitiatorStateFromSeed creates a new initiator UAKE instance, with
+// the ephemeral key pair and the encapsulation derived deterministically
+// from a SymSize byte seed (via NewSHAKEReader), for reproducible handshake
+// tests and test vector generation.
+//
+// WARNING: Reusing a seed reuses the ephemeral key pair and the initiator's
+// KEM shared secret, so this MUST NOT be used outside of testing, unless the
+// seed is generated freshly from a cryptographic entropy source each time.
+func (pk *PublicKey) NewUAKEInitiatorStateFromSeed(seed []byte) (*UAKEInitiatorState, error) {
+	if len(seed) != SymSize {
+		return nil, ErrInvalidSeedSize
+	}
+
+	return pk.NewUAKEInitiatorState(NewSHAKEReader(seed))
+}
+
+// NewUAKEInitiatorStateWithEphemeral creates a new initiator UAKE instance,
+// using a caller provided ephemeral private key (eg: for deterministic
+// testing, or a hardware-backed ephemeral key) instead of generating one.
+// The cipher text is still generated with entropy from rng.
+//
+// The ephemeral private key MUST NOT be used for anything else, and MUST
+// be from the same ParameterSet as the PublicKey, or ErrParameterSetMismatch
+// will be returned.
+func (pk *PublicKey) NewUAKEInitiatorStateWithEphemeral(eSk *PrivateKey, rng io.Reader) (*UAKEInitiatorState, error) {
+	if rng == nil {
+		return nil, ErrNilRandomSource
+	}
+	if eSk == nil || eSk.PublicKey.p != pk.p {
+		return nil, ErrParameterSetMismatch
+	}
+
+	s := new(UAKEInitiatorState)
+	s.Message = make([]byte, 0, pk.p.UAKEInitiatorMessageSize())
+	s.eSk = eSk
 	s.Message = append(s.Message, s.eSk.PublicKey.Bytes()...)
 
 	var ct []byte
+	var err error
 	ct, s.tk, err = pk.KEMEncrypt(rng)
 	if err != nil {
 		return nil, err
@@ -88,27 +305,51 @@ func (pk *PublicKey) NewUAKEInitiatorState(rng io.Reader) (*UAKEInitiatorState,
 	return s, nil
 }
 
+// ParseUAKEInitiatorMessage splits a UAKE (or AKE) initiator message into
+// the initiator's ephemeral public key and the cipher text.  The returned
+// cipher text aliases recv.
+func (p *ParameterSet) ParseUAKEInitiatorMessage(recv []byte) (*PublicKey, []byte, error) {
+	if len(recv) != p.UAKEInitiatorMessageSize() {
+		return nil, nil, ErrInvalidMessageSize
+	}
+
+	pkLen := p.PublicKeySize()
+	pk, err := p.PublicKeyFromBytes(recv[:pkLen])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pk, recv[pkLen:], nil
+}
+
+// UAKEInitiatorEphemeralKey parses just the initiator's ephemeral public key
+// from a UAKE (or AKE) initiator message, without performing the KEM, eg:
+// for logging, rate-limiting by key, or protocol inspection.
+func (p *ParameterSet) UAKEInitiatorEphemeralKey(recv []byte) (*PublicKey, error) {
+	pk, _, err := p.ParseUAKEInitiatorMessage(recv)
+	return pk, err
+}
+
 // UAKEResponderShared generates a responder message and shared secret given
-// a initiator UAKE message.
+// a initiator UAKE message, and the responder's long term private key, which
+// may be a PrivateKey, or any other Decapsulator for the ParameterSet (eg: a
+// HSM backed key).
 //
 // On failures, sharedSecret will contain a randomized value.  Providing a
-// cipher text that is obviously malformed (too large/small) will result in a
-// panic.
-func (sk *PrivateKey) UAKEResponderShared(rng io.Reader, recv []byte) (message, sharedSecret []byte) {
-	p := sk.PublicKey.p
-	pkLen := p.PublicKeySize()
+// cipher text that is obviously malformed (too large/small), or a nil rng
+// will result in a panic, as will a Decapsulator error.
+func (p *ParameterSet) UAKEResponderShared(rng io.Reader, recv []byte, sk Decapsulator) (message, sharedSecret []byte) {
+	if rng == nil {
+		panic(ErrNilRandomSource)
+	}
 
 	// Deserialize the peer's ephemeral public key.
-	if len(recv) != p.UAKEInitiatorMessageSize() {
-		panic(ErrInvalidMessageSize)
-	}
-	rawPk, ct := recv[:pkLen], recv[pkLen:]
-	pk, err := p.PublicKeyFromBytes(rawPk)
+	pk, ct, err := p.ParseUAKEInitiatorMessage(recv)
 	if err != nil {
 		panic(err)
 	}
 
-	xof := sha3.NewShake256()
+	xof := hashImpl.NewShake256()
 	var tk []byte
 
 	message, tk, err = pk.KEMEncrypt(rng)
@@ -116,10 +357,14 @@ func (sk *PrivateKey) UAKEResponderShared(rng io.Reader, recv []byte) (message,
 		panic(err)
 	}
 	xof.Write(tk)
+	zeroize(tk)
 
-	tk = sk.KEMDecrypt(ct)
+	if tk, err = sk.Decapsulate(ct); err != nil {
+		panic(err)
+	}
 	xof.Write(tk)
-	sharedSecret = make([]byte, SymSize)
+	zeroize(tk)
+	sharedSecret = make([]byte, SharedSecretSize)
 	xof.Read(sharedSecret)
 
 	return
@@ -137,14 +382,49 @@ func (p *ParameterSet) AKEResponderMessageSize() int {
 	return 2 * p.CipherTextSize()
 }
 
+// AKEInitiatorRandomSize returns the number of bytes of entropy consumed
+// from the io.Reader by NewAKEInitiatorState.
+func (p *ParameterSet) AKEInitiatorRandomSize() int {
+	return p.KeyGenRandomSize() + p.EncapsulationRandomSize()
+}
+
+// AKEResponderRandomSize returns the number of bytes of entropy consumed
+// from the io.Reader by AKEResponderShared.
+func (p *ParameterSet) AKEResponderRandomSize() int {
+	return 2 * p.EncapsulationRandomSize()
+}
+
+// AKEHandshakeSize returns the total size of the messages exchanged in an
+// AKE handshake (initiator and responder) in bytes.
+func (p *ParameterSet) AKEHandshakeSize() int {
+	return p.AKEInitiatorMessageSize() + p.AKEResponderMessageSize()
+}
+
+// AKEContributions are the individual KEM shared secrets that an AKE shared
+// secret is derived from, as returned by the debug AKE variants.
+type AKEContributions struct {
+	// Ephemeral is the shared secret encapsulated by the responder to the
+	// initiator's ephemeral public key.
+	Ephemeral []byte
+
+	// InitiatorStatic is the shared secret encapsulated by the responder to
+	// the initiator's long term public key.
+	InitiatorStatic []byte
+
+	// ResponderStatic is the shared secret encapsulated by the initiator to
+	// the responder's long term public key.
+	ResponderStatic []byte
+}
+
 // AKEInitiatorState is a initiator AKE instance.  Each instance MUST only be
 // used for one key exchange and never reused.
 type AKEInitiatorState struct {
 	// Message is the AKE message to send to the responder.
 	Message []byte
 
-	eSk *PrivateKey
-	tk  []byte
+	eSk  *PrivateKey
+	tk   []byte
+	used bool
 }
 
 // Shared generates a shared secret for the given AKE instance, responder
@@ -153,7 +433,33 @@ type AKEInitiatorState struct {
 // On failures sharedSecret will contain a randomized value.   Providing a
 // malformed responder message, or a private key that uses a different
 // ParamterSet than the AKEInitiatorState will result in a panic.
+//
+// Calling Shared more than once on the same instance will result in a panic.
+// A malformed message (or mismatched private key) is rejected before the
+// instance is marked as used, so it does not count as a call.
 func (s *AKEInitiatorState) Shared(recv []byte, initiatorPrivateKey *PrivateKey) (sharedSecret []byte) {
+	return s.shared(recv, initiatorPrivateKey, nil)
+}
+
+// SharedDebug is Shared, except that the individual KEM shared secrets that
+// the AKE shared secret is derived from are additionally returned, so that a
+// developer can pinpoint which KEM leg of a failed handshake diverged.
+//
+// WARNING: The returned contributions are sufficient to recompute the shared
+// secret, and exposing them COMPLETELY BREAKS the security of the key
+// exchange.  This is ONLY intended for debugging during development, and
+// MUST NOT be used in production.
+func (s *AKEInitiatorState) SharedDebug(recv []byte, initiatorPrivateKey *PrivateKey) (sharedSecret []byte, contributions *AKEContributions) {
+	contributions = new(AKEContributions)
+	sharedSecret = s.shared(recv, initiatorPrivateKey, contributions)
+
+	return
+}
+
+func (s *AKEInitiatorState) shared(recv []byte, initiatorPrivateKey *PrivateKey, debug *AKEContributions) (sharedSecret []byte) {
+	if s.used {
+		panic(ErrStateReused)
+	}
 	p := s.eSk.PublicKey.p
 
 	if initiatorPrivateKey.PublicKey.p != p {
@@ -163,23 +469,59 @@ func (s *AKEInitiatorState) Shared(recv []byte, initiatorPrivateKey *PrivateKey)
 		panic(ErrInvalidMessageSize)
 	}
 	ctLen := p.CipherTextSize()
+	s.used = true
 
-	xof := sha3.NewShake256()
+	xof := hashImpl.NewShake256()
 	var tk []byte
 
 	tk = s.eSk.KEMDecrypt(recv[:ctLen])
 	xof.Write(tk)
+	if debug != nil {
+		debug.Ephemeral = append([]byte{}, tk...)
+	}
+	zeroize(tk)
 
 	tk = initiatorPrivateKey.KEMDecrypt(recv[ctLen:])
 	xof.Write(tk)
+	if debug != nil {
+		debug.InitiatorStatic = append([]byte{}, tk...)
+	}
+	zeroize(tk)
 
 	xof.Write(s.tk)
-	sharedSecret = make([]byte, SymSize)
+	if debug != nil {
+		debug.ResponderStatic = append([]byte{}, s.tk...)
+	}
+	zeroize(s.tk)
+	sharedSecret = make([]byte, SharedSecretSize)
 	xof.Read(sharedSecret)
 
 	return
 }
 
+// Zeroize overwrites the ephemeral private key, the initiator's KEM shared
+// secret, and the message of the AKE instance with zeros, and marks it as
+// used.  Shared only wipes the KEM shared secret, as the message may still
+// be required (eg: for a transcript), so this SHOULD be called once the
+// key exchange has completed (or been abandoned).
+func (s *AKEInitiatorState) Zeroize() {
+	s.eSk.Zeroize()
+	zeroize(s.tk)
+	zeroize(s.Message)
+	s.used = true
+}
+
+// SharedWithTranscript is Shared, except that the initiator and responder
+// messages are additionally written, in that order, to the transcript
+// io.Writer (eg: a hash.Hash).  A transcript write failure will result in a
+// panic.
+func (s *AKEInitiatorState) SharedWithTranscript(recv []byte, initiatorPrivateKey *PrivateKey, transcript io.Writer) (sharedSecret []byte) {
+	sharedSecret = s.Shared(recv, initiatorPrivateKey)
+	writeTranscript(transcript, s.Message, recv)
+
+	return
+}
+
 // NewAKEInitiatorState creates a new initiator AKE instance.
 func (pk *PublicKey) NewAKEInitiatorState(rng io.Reader) (*AKEInitiatorState, error) {
 	s := new(AKEInitiatorState)
@@ -198,32 +540,53 @@ func (pk *PublicKey) NewAKEInitiatorState(rng io.Reader) (*AKEInitiatorState, er
 }
 
 // AKEResponderShared generates a responder message and shared secret given
-// a initiator AKE message and long term initiator public key.
+// a initiator AKE message, the responder's long term private key, which may
+// be a PrivateKey, or any other Decapsulator for the ParameterSet (eg: a HSM
+// backed key), and the long term initiator public key.
 //
 // On failures sharedSecret will contain a randomized value.   Providing a
-// malformed responder message, or a private key that uses a different
-// ParamterSet than the AKEInitiatorState will result in a panic.
-func (sk *PrivateKey) AKEResponderShared(rng io.Reader, recv []byte, peerPublicKey *PublicKey) (message, sharedSecret []byte) {
-	p := sk.PublicKey.p
-	pkLen := p.PublicKeySize()
+// malformed responder message, or a peer public key that uses a different
+// ParamterSet, or a nil rng will result in a panic, as will a Decapsulator
+// error.
+func (p *ParameterSet) AKEResponderShared(rng io.Reader, recv []byte, sk Decapsulator, peerPublicKey *PublicKey) (message, sharedSecret []byte) {
+	return p.akeResponderShared(rng, recv, sk, peerPublicKey, nil)
+}
+
+// AKEResponderSharedDebug is AKEResponderShared, except that the individual
+// KEM shared secrets that the AKE shared secret is derived from are
+// additionally returned, so that a developer can pinpoint which KEM leg of a
+// failed handshake diverged.
+//
+// WARNING: The returned contributions are sufficient to recompute the shared
+// secret, and exposing them COMPLETELY BREAKS the security of the key
+// exchange.  This is ONLY intended for debugging during development, and
+// MUST NOT be used in production.
+func (p *ParameterSet) AKEResponderSharedDebug(rng io.Reader, recv []byte, sk Decapsulator, peerPublicKey *PublicKey) (message, sharedSecret []byte, contributions *AKEContributions) {
+	contributions = new(AKEContributions)
+	message, sharedSecret = p.akeResponderShared(rng, recv, sk, peerPublicKey, contributions)
+
+	return
+}
+
+func (p *ParameterSet) akeResponderShared(rng io.Reader, recv []byte, sk Decapsulator, peerPublicKey *PublicKey, debug *AKEContributions) (message, sharedSecret []byte) {
+	if rng == nil {
+		panic(ErrNilRandomSource)
+	}
 
 	if peerPublicKey.p != p {
 		panic(ErrParameterSetMismatch)
 	}
 
-	// Deserialize the peer's ephemeral public key.
-	if len(recv) != p.AKEInitiatorMessageSize() {
-		panic(ErrInvalidMessageSize)
-	}
-	rawPk, ct := recv[:pkLen], recv[pkLen:]
-	pk, err := p.PublicKeyFromBytes(rawPk)
+	// Deserialize the peer's ephemeral public key.  The AKE initiator
+	// message has the same framing as the UAKE one.
+	pk, ct, err := p.ParseUAKEInitiatorMessage(recv)
 	if err != nil {
 		panic(err)
 	}
 
 	message = make([]byte, 0, p.AKEResponderMessageSize())
 
-	xof := sha3.NewShake256()
+	xof := hashImpl.NewShake256()
 	var tk, tmp []byte
 
 	tmp, tk, err = pk.KEMEncrypt(rng)
@@ -231,6 +594,10 @@ func (sk *PrivateKey) AKEResponderShared(rng io.Reader, recv []byte, peerPublicK
 		panic(err)
 	}
 	xof.Write(tk)
+	if debug != nil {
+		debug.Ephemeral = append([]byte{}, tk...)
+	}
+	zeroize(tk)
 	message = append(message, tmp...)
 
 	tmp, tk, err = peerPublicKey.KEMEncrypt(rng)
@@ -238,12 +605,173 @@ func (sk *PrivateKey) AKEResponderShared(rng io.Reader, recv []byte, peerPublicK
 		panic(err)
 	}
 	xof.Write(tk)
+	if debug != nil {
+		debug.InitiatorStatic = append([]byte{}, tk...)
+	}
+	zeroize(tk)
 	message = append(message, tmp...)
 
-	tk = sk.KEMDecrypt(ct)
+	if tk, err = sk.Decapsulate(ct); err != nil {
+		panic(err)
+	}
 	xof.Write(tk)
-	sharedSecret = make([]byte, SymSize)
+	if debug != nil {
+		debug.ResponderStatic = append([]byte{}, tk...)
+	}
+	zeroize(tk)
+	sharedSecret = make([]byte, SharedSecretSize)
 	xof.Read(sharedSecret)
 
 	return
 }
+
+// AKEResponderSharedWithTranscript is AKEResponderShared, except that the
+// initiator and responder messages are additionally written, in that order,
+// to the transcript io.Writer (eg: a hash.Hash).  A transcript write failure
+// will result in a panic.
+func (p *ParameterSet) AKEResponderSharedWithTranscript(rng io.Reader, recv []byte, sk Decapsulator, peerPublicKey *PublicKey, transcript io.Writer) (message, sharedSecret []byte) {
+	message, sharedSecret = p.AKEResponderShared(rng, recv, sk, peerPublicKey)
+	writeTranscript(transcript, recv, message)
+
+	return
+}
+
+func writeTranscript(w io.Writer, initiatorMessage, responderMessage []byte) {
+	if _, err := w.Write(initiatorMessage); err != nil {
+		panic(err)
+	}
+	if _, err := w.Write(responderMessage); err != nil {
+		panic(err)
+	}
+}
+
+// DeriveSessionID derives a SymSize byte session identifier from a shared
+// secret and a caller provided context label.  The identifier is domain
+// separated from the shared secret, and is suitable for use as a public
+// value, unlike the shared secret itself.
+func DeriveSessionID(sharedSecret, context []byte) []byte {
+	return expandSecret(sessionIDDomainSep, sharedSecret, context, SymSize)
+}
+
+// ExpandSharedSecret derives n bytes of key material from a shared secret
+// and a caller provided context label, with SHAKE-256.  The output is domain
+// separated from DeriveSessionID.
+//
+// Lengths of 0 or greater than MaxExpandedSize are rejected with
+// ErrInvalidLength, as they are almost certainly a bug, and would otherwise
+// silently allocate and squeeze the XOF for a long time.
+func ExpandSharedSecret(sharedSecret, context []byte, n int) ([]byte, error) {
+	if n <= 0 || n > MaxExpandedSize {
+		return nil, ErrInvalidLength
+	}
+
+	return expandSecret(expandDomainSep, sharedSecret, context, n), nil
+}
+
+// DeriveKeys splits a shared secret into len(labels) sub-keys, where the
+// i-th sub-key is lengths[i] bytes long.  A single SHAKE-256 instance is
+// keyed by the shared secret, and each sub-key is squeezed from a copy of
+// it after absorbing the sub-key's label, so the sub-keys are independent
+// of each other, and domain separated from ExpandSharedSecret.
+//
+// Labels must be unique, and each length is subject to the same limits as
+// ExpandSharedSecret.
+func DeriveKeys(sharedSecret []byte, labels []string, lengths []int) ([][]byte, error) {
+	if len(labels) == 0 || len(labels) != len(lengths) {
+		return nil, ErrInvalidLabels
+	}
+	seen := make(map[string]bool, len(labels))
+	for i, label := range labels {
+		if seen[label] {
+			return nil, ErrInvalidLabels
+		}
+		seen[label] = true
+		if lengths[i] <= 0 || lengths[i] > MaxExpandedSize {
+			return nil, ErrInvalidLength
+		}
+	}
+
+	var l [8]byte
+	keyed := hashImpl.NewShake256()
+	keyed.Write(deriveKeysDomainSep)
+	binary.BigEndian.PutUint64(l[:], uint64(len(sharedSecret)))
+	keyed.Write(l[:])
+	keyed.Write(sharedSecret)
+
+	keys := make([][]byte, 0, len(labels))
+	for i, label := range labels {
+		xof := keyed.Clone()
+		binary.BigEndian.PutUint64(l[:], uint64(len(label)))
+		xof.Write(l[:])
+		xof.Write([]byte(label))
+
+		k := make([]byte, lengths[i])
+		xof.Read(k)
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+// Role is the role of a party in a key exchange, used to separate the key
+// confirmation tags sent by each side.
+type Role int
+
+const (
+	// RoleInitiator is the role of the party that sends the first message.
+	RoleInitiator Role = iota + 1
+
+	// RoleResponder is the role of the party that responds to the initiator.
+	RoleResponder
+)
+
+// KeyConfirmation returns a SymSize byte key confirmation tag sent by the
+// party with the given role, that is a SHAKE-256 MAC over the handshake
+// transcript keyed by the shared secret, so that a peer can prove that it
+// derived the same shared secret before application data is sent.  The tags
+// for each role are distinct, so a tag can not be reflected back to the
+// party that sent it.  The tag is domain separated from DeriveSessionID and
+// ExpandSharedSecret, and is safe to send in the clear.
+//
+// This will panic if sender is not RoleInitiator or RoleResponder.
+func KeyConfirmation(sharedSecret, transcript []byte, sender Role) []byte {
+	var domainSep []byte
+	switch sender {
+	case RoleInitiator:
+		domainSep = confirmInitiatorDomainSep
+	case RoleResponder:
+		domainSep = confirmResponderDomainSep
+	default:
+		panic("kyber: invalid key confirmation role")
+	}
+
+	return expandSecret(domainSep, sharedSecret, transcript, SymSize)
+}
+
+// VerifyKeyConfirmation returns true iff tag is the valid key confirmation
+// tag sent by the party with the given role (ie: the peer's role, not that
+// of the caller), for the shared secret and transcript, in constant time.
+//
+// This will panic if sender is not RoleInitiator or RoleResponder.
+func VerifyKeyConfirmation(sharedSecret, transcript, tag []byte, sender Role) bool {
+	expected := KeyConfirmation(sharedSecret, transcript, sender)
+	return subtle.ConstantTimeCompare(expected, tag) == 1
+}
+
+func expandSecret(domainSep, sharedSecret, context []byte, n int) []byte {
+	var l [8]byte
+
+	xof := hashImpl.NewShake256()
+	xof.Write(domainSep)
+	binary.BigEndian.PutUint64(l[:], uint64(len(sharedSecret)))
+	xof.Write(l[:])
+	xof.Write(sharedSecret)
+	binary.BigEndian.PutUint64(l[:], uint64(len(context)))
+	xof.Write(l[:])
+	xof.Write(context)
+
+	out := make([]byte, n)
+	xof.Read(out)
+
+	return out
+}
@@ -8,6 +8,7 @@
 package kyber
 
 import (
+	"bytes"
 	"crypto/rand"
 	"testing"
 
@@ -29,44 +30,290 @@ func TestAKE(t *testing.T) {
 func doTestKEX(t *testing.T) {
 	impl := "_" + hardwareAccelImpl.name
 	for _, p := range allParams {
+		t.Run(p.Name()+"_KEX"+impl, func(t *testing.T) { doTestEphemeralKEX(t, p) })
 		t.Run(p.Name()+"_UAKE"+impl, func(t *testing.T) { doTestUAKE(t, p) })
 		t.Run(p.Name()+"_AKE"+impl, func(t *testing.T) { doTestAKE(t, p) })
 	}
 }
 
+func TestDeriveSessionID(t *testing.T) {
+	require := require.New(t)
+
+	ss := make([]byte, SymSize)
+	_, err := rand.Read(ss)
+	require.NoError(err, "rand.Read()")
+
+	id := DeriveSessionID(ss, []byte("context"))
+	require.Len(id, SymSize, "DeriveSessionID(): Length")
+	require.NotEqual(ss, id, "DeriveSessionID(): Equals shared secret")
+	require.Equal(id, DeriveSessionID(ss, []byte("context")), "DeriveSessionID(): Deterministic")
+	require.NotEqual(id, DeriveSessionID(ss, []byte("context2")), "DeriveSessionID(): Context ignored")
+
+	// Moving bytes between the secret and context must change the output.
+	require.NotEqual(DeriveSessionID(ss[:SymSize-1], append([]byte{ss[SymSize-1]}, "context"...)), id, "DeriveSessionID(): Ambiguous encoding")
+}
+
+func TestExpandSharedSecret(t *testing.T) {
+	require := require.New(t)
+
+	ss := make([]byte, SymSize)
+	_, err := rand.Read(ss)
+	require.NoError(err, "rand.Read()")
+
+	for _, n := range []int{1, SymSize, 1000, MaxExpandedSize} {
+		b, err := ExpandSharedSecret(ss, []byte("context"), n)
+		require.NoError(err, "ExpandSharedSecret(): %d", n)
+		require.Len(b, n, "ExpandSharedSecret(): %d", n)
+	}
+
+	b, err := ExpandSharedSecret(ss, []byte("context"), SymSize)
+	require.NoError(err, "ExpandSharedSecret()")
+	require.NotEqual(DeriveSessionID(ss, []byte("context")), b, "ExpandSharedSecret(): Not domain separated")
+
+	for _, n := range []int{-1, 0, MaxExpandedSize + 1} {
+		_, err = ExpandSharedSecret(ss, nil, n)
+		require.Equal(ErrInvalidLength, err, "ExpandSharedSecret(): %d", n)
+	}
+}
+
+func TestDeriveKeys(t *testing.T) {
+	require := require.New(t)
+
+	ss := make([]byte, SymSize)
+	_, err := rand.Read(ss)
+	require.NoError(err, "rand.Read()")
+
+	labels := []string{"client-key", "server-key", "client-iv"}
+	lengths := []int{SymSize, SymSize, 12}
+	keys, err := DeriveKeys(ss, labels, lengths)
+	require.NoError(err, "DeriveKeys()")
+	require.Len(keys, len(labels), "DeriveKeys(): Count")
+	for i, k := range keys {
+		require.Len(k, lengths[i], "DeriveKeys(): %s: Length", labels[i])
+	}
+	require.NotEqual(keys[0], keys[1], "DeriveKeys(): Not domain separated by label")
+
+	// Each sub-key only depends on its own label and length.
+	keys2, err := DeriveKeys(ss, []string{"server-key", "client-key"}, []int{SymSize, 2 * SymSize})
+	require.NoError(err, "DeriveKeys(): Reordered")
+	require.Equal(keys[1], keys2[0], "DeriveKeys(): Reordered")
+	require.Equal(keys[0], keys2[1][:SymSize], "DeriveKeys(): Longer")
+
+	b, err := ExpandSharedSecret(ss, []byte(labels[0]), SymSize)
+	require.NoError(err, "ExpandSharedSecret()")
+	require.NotEqual(b, keys[0], "DeriveKeys(): Equals ExpandSharedSecret()")
+
+	for _, v := range []struct {
+		labels  []string
+		lengths []int
+		err     error
+	}{
+		{nil, nil, ErrInvalidLabels},
+		{[]string{"a", "b"}, []int{SymSize}, ErrInvalidLabels},
+		{[]string{"a", "a"}, []int{SymSize, SymSize}, ErrInvalidLabels},
+		{[]string{"a", "b"}, []int{SymSize, 0}, ErrInvalidLength},
+		{[]string{"a"}, []int{MaxExpandedSize + 1}, ErrInvalidLength},
+	} {
+		_, err = DeriveKeys(ss, v.labels, v.lengths)
+		require.Equal(v.err, err, "DeriveKeys(%q, %v)", v.labels, v.lengths)
+	}
+}
+
+func TestKeyConfirmation(t *testing.T) {
+	require := require.New(t)
+
+	ss := make([]byte, SymSize)
+	_, err := rand.Read(ss)
+	require.NoError(err, "rand.Read()")
+	transcript := []byte("transcript")
+
+	tag := KeyConfirmation(ss, transcript, RoleInitiator)
+	require.Len(tag, SymSize, "KeyConfirmation(): Length")
+	require.True(VerifyKeyConfirmation(ss, transcript, tag, RoleInitiator), "VerifyKeyConfirmation()")
+
+	// The tags for each role must differ, so that a tag reflected back to
+	// the party that sent it is rejected.
+	respTag := KeyConfirmation(ss, transcript, RoleResponder)
+	require.True(VerifyKeyConfirmation(ss, transcript, respTag, RoleResponder), "VerifyKeyConfirmation(): Responder")
+	require.NotEqual(tag, respTag, "KeyConfirmation(): Roles")
+	require.False(VerifyKeyConfirmation(ss, transcript, tag, RoleResponder), "VerifyKeyConfirmation(): Reflected initiator tag")
+	require.False(VerifyKeyConfirmation(ss, transcript, respTag, RoleInitiator), "VerifyKeyConfirmation(): Reflected responder tag")
+	require.Panics(func() { KeyConfirmation(ss, transcript, Role(0)) }, "KeyConfirmation(): Invalid role")
+
+	// The tag must be domain separated from session keys.
+	require.NotEqual(DeriveSessionID(ss, transcript), tag, "KeyConfirmation(): Equals DeriveSessionID()")
+	b, err := ExpandSharedSecret(ss, transcript, SymSize)
+	require.NoError(err, "ExpandSharedSecret()")
+	require.NotEqual(b, tag, "KeyConfirmation(): Equals ExpandSharedSecret()")
+
+	require.False(VerifyKeyConfirmation(ss, []byte("transcript2"), tag, RoleInitiator), "VerifyKeyConfirmation(): Wrong transcript")
+	require.False(VerifyKeyConfirmation(ss, transcript, tag[1:], RoleInitiator), "VerifyKeyConfirmation(): Truncated")
+	tag[0] ^= 0x01
+	require.False(VerifyKeyConfirmation(ss, transcript, tag, RoleInitiator), "VerifyKeyConfirmation(): Corrupted")
+}
+
+func doTestEphemeralKEX(t *testing.T, p *ParameterSet) {
+	require := require.New(t)
+
+	for i := 0; i < nTests; i++ {
+		// Create the initiator state.
+		rng := newExactReader(require, p.KEXInitiatorRandomSize())
+		stateA, err := p.NewKEXInitiatorState(rng)
+		require.NoError(err, "NewKEXInitiatorState()")
+		require.Zero(rng.Len(), "NewKEXInitiatorState(): Unused entropy")
+		require.Len(stateA.Message, p.KEXInitiatorMessageSize(), "stateA.Message: Length")
+
+		// Create the responder message and shared secret.
+		rng = newExactReader(require, p.KEXResponderRandomSize())
+		msgB, ssB := p.KEXResponderShared(rng, stateA.Message)
+		require.Zero(rng.Len(), "KEXResponderShared(): Unused entropy")
+		require.Len(msgB, p.KEXResponderMessageSize(), "KEXResponderShared(): msgB Length")
+		require.Len(ssB, SymSize, "KEXResponderShared(): ssB Length")
+
+		// A malformed message must be rejected, without using up the state.
+		require.PanicsWithValue(ErrInvalidMessageSize, func() { stateA.Shared(msgB[1:]) }, "Shared(): Short")
+
+		// Create the initiator shared secret.
+		ssA := stateA.Shared(msgB)
+		require.Equal(ssA, ssB, "Shared secret mismatch")
+
+		// Reusing the initiator state must be rejected.
+		require.PanicsWithValue(ErrStateReused, func() { stateA.Shared(msgB) }, "Shared(): Reuse")
+	}
+
+	_, err := p.NewKEXInitiatorState(nil)
+	require.Equal(ErrNilRandomSource, err, "NewKEXInitiatorState(nil)")
+	msg := make([]byte, p.KEXInitiatorMessageSize())
+	require.PanicsWithValue(ErrNilRandomSource, func() { p.KEXResponderShared(nil, msg) }, "KEXResponderShared(nil)")
+	require.PanicsWithValue(ErrInvalidMessageSize, func() { p.KEXResponderShared(rand.Reader, msg[1:]) }, "KEXResponderShared(): Short")
+}
+
 func doTestUAKE(t *testing.T, p *ParameterSet) {
 	require := require.New(t)
 
 	t.Logf("UAKEInitiatorMessageSize(): %v", p.UAKEInitiatorMessageSize())
 	t.Logf("UAKEResponderMessageSize(): %v", p.UAKEResponderMessageSize())
 
+	require.Equal(p.PublicKeySize()+2*p.CipherTextSize(), p.UAKEHandshakeSize(), "UAKEHandshakeSize()")
+
 	for i := 0; i < nTests; i++ {
 		// Generate the responder key pair.
 		pkB, skB, err := p.GenerateKeyPair(rand.Reader)
 		require.NoError(err, "GenerateKeyPair()")
 
 		// Create the initiator state.
-		stateA, err := pkB.NewUAKEInitiatorState(rand.Reader)
+		rng := newExactReader(require, p.UAKEInitiatorRandomSize())
+		stateA, err := pkB.NewUAKEInitiatorState(rng)
 		require.NoError(err, "NewUAKEInitiatorState()")
+		require.Zero(rng.Len(), "NewUAKEInitiatorState(): Unused entropy")
 		require.Len(stateA.Message, p.UAKEInitiatorMessageSize(), "stateA.Message: Length")
 
+		// Parse the initiator message.
+		pkA, ctA, err := p.ParseUAKEInitiatorMessage(stateA.Message)
+		require.NoError(err, "ParseUAKEInitiatorMessage()")
+		requirePublicKeyEqual(require, &stateA.eSk.PublicKey, pkA)
+		require.Equal(stateA.Message[p.PublicKeySize():], ctA, "ParseUAKEInitiatorMessage(): ct")
+		_, _, err = p.ParseUAKEInitiatorMessage(stateA.Message[1:])
+		require.Equal(ErrInvalidMessageSize, err, "ParseUAKEInitiatorMessage(): Short")
+		ePk, err := p.UAKEInitiatorEphemeralKey(stateA.Message)
+		require.NoError(err, "UAKEInitiatorEphemeralKey()")
+		requirePublicKeyEqual(require, pkA, ePk)
+		_, err = p.UAKEInitiatorEphemeralKey(stateA.Message[1:])
+		require.Equal(ErrInvalidMessageSize, err, "UAKEInitiatorEphemeralKey(): Short")
+
 		// Create the responder message and shared secret.
-		msgB, ssB := skB.UAKEResponderShared(rand.Reader, stateA.Message)
+		rng = newExactReader(require, p.UAKEResponderRandomSize())
+		msgB, ssB := p.UAKEResponderShared(rng, stateA.Message, skB)
+		require.Zero(rng.Len(), "UAKEResponderShared(): Unused entropy")
 		require.Len(msgB, p.UAKEResponderMessageSize(), "UAKEResponderShared(): msgB Length")
 		require.Len(ssB, SymSize, "UAKEResponderShared(): ssB Length")
 
+		// A malformed message must be rejected, without using up the state.
+		require.PanicsWithValue(ErrInvalidMessageSize, func() { stateA.Shared(msgB[1:]) }, "Shared(): Short")
+		require.PanicsWithValue(ErrInvalidMessageSize, func() { stateA.Shared(append(msgB, 0)) }, "Shared(): Long")
+
 		// Create the initiator shared secret.
 		ssA := stateA.Shared(msgB)
 		require.Equal(ssA, ssB, "Shared secret mismatch")
+		require.Equal(make([]byte, SymSize), stateA.tk, "Shared(): tk not wiped")
+
+		// Reusing the initiator state must be rejected.
+		require.PanicsWithValue(ErrStateReused, func() { stateA.Shared(msgB) }, "Shared(): Reuse")
 	}
 }
 
+func TestUAKEWithEphemeral(t *testing.T) {
+	require := require.New(t)
+
+	p := Kyber768
+	pkB, skB, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Responder")
+	_, eSk, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Ephemeral")
+
+	// With a caller provided ephemeral key, the initiator is deterministic
+	// given the rng.
+	seed := []byte("TestUAKEWithEphemeral")
+	stateA, err := pkB.NewUAKEInitiatorStateWithEphemeral(eSk, NewSHAKEReader(seed))
+	require.NoError(err, "NewUAKEInitiatorStateWithEphemeral()")
+	require.Equal(eSk.PublicKey.Bytes(), stateA.Message[:p.PublicKeySize()], "NewUAKEInitiatorStateWithEphemeral(): Ephemeral key")
+	stateA2, err := pkB.NewUAKEInitiatorStateWithEphemeral(eSk, NewSHAKEReader(seed))
+	require.NoError(err, "NewUAKEInitiatorStateWithEphemeral(): Again")
+	require.Equal(stateA.Message, stateA2.Message, "NewUAKEInitiatorStateWithEphemeral(): Deterministic")
+
+	msgB, ssB := p.UAKEResponderShared(rand.Reader, stateA.Message, skB)
+	require.Equal(ssB, stateA.Shared(msgB), "Shared secret mismatch")
+
+	_, wrongSk, err := Kyber512.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Kyber512")
+	_, err = pkB.NewUAKEInitiatorStateWithEphemeral(wrongSk, rand.Reader)
+	require.Equal(ErrParameterSetMismatch, err, "NewUAKEInitiatorStateWithEphemeral(): Mismatch")
+	_, err = pkB.NewUAKEInitiatorStateWithEphemeral(nil, rand.Reader)
+	require.Equal(ErrParameterSetMismatch, err, "NewUAKEInitiatorStateWithEphemeral(nil, rng)")
+	_, err = pkB.NewUAKEInitiatorStateWithEphemeral(eSk, nil)
+	require.Equal(ErrNilRandomSource, err, "NewUAKEInitiatorStateWithEphemeral(eSk, nil)")
+}
+
+func TestUAKEFromSeed(t *testing.T) {
+	require := require.New(t)
+
+	p := Kyber768
+	pkB, skB, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Responder")
+
+	var seed [SymSize]byte
+	_, err = rand.Read(seed[:])
+	require.NoError(err, "rand.Read()")
+
+	stateA, err := pkB.NewUAKEInitiatorStateFromSeed(seed[:])
+	require.NoError(err, "NewUAKEInitiatorStateFromSeed()")
+	stateA2, err := pkB.NewUAKEInitiatorStateFromSeed(seed[:])
+	require.NoError(err, "NewUAKEInitiatorStateFromSeed(): Again")
+	require.Equal(stateA.Message, stateA2.Message, "NewUAKEInitiatorStateFromSeed(): Deterministic")
+	require.Equal(stateA.tk, stateA2.tk, "NewUAKEInitiatorStateFromSeed(): Deterministic tk")
+
+	seed[0] ^= 0x01
+	stateA3, err := pkB.NewUAKEInitiatorStateFromSeed(seed[:])
+	require.NoError(err, "NewUAKEInitiatorStateFromSeed(): Different seed")
+	require.NotEqual(stateA.Message, stateA3.Message, "NewUAKEInitiatorStateFromSeed(): Different seed")
+
+	msgB, ssB := p.UAKEResponderShared(rand.Reader, stateA.Message, skB)
+	require.Equal(ssB, stateA.Shared(msgB), "Shared secret mismatch")
+
+	_, err = pkB.NewUAKEInitiatorStateFromSeed(seed[1:])
+	require.Equal(ErrInvalidSeedSize, err, "NewUAKEInitiatorStateFromSeed(): Short seed")
+	_, err = pkB.NewUAKEInitiatorStateFromSeed(append(seed[:], 0))
+	require.Equal(ErrInvalidSeedSize, err, "NewUAKEInitiatorStateFromSeed(): Long seed")
+}
+
 func doTestAKE(t *testing.T, p *ParameterSet) {
 	require := require.New(t)
 
 	t.Logf("AKEInitiatorMessageSize(): %v", p.AKEInitiatorMessageSize())
 	t.Logf("AKEResponderMessageSize(): %v", p.AKEResponderMessageSize())
 
+	require.Equal(p.PublicKeySize()+3*p.CipherTextSize(), p.AKEHandshakeSize(), "AKEHandshakeSize()")
+
 	for i := 0; i < nTests; i++ {
 		// Generate the initiator and responder key pairs.
 		pkB, skB, err := p.GenerateKeyPair(rand.Reader)
@@ -76,17 +323,174 @@ func doTestAKE(t *testing.T, p *ParameterSet) {
 		require.NoError(err, "GenerateKeyPair(): Initiator")
 
 		// Create the initiator state.
-		stateA, err := pkB.NewAKEInitiatorState(rand.Reader)
+		rng := newExactReader(require, p.AKEInitiatorRandomSize())
+		stateA, err := pkB.NewAKEInitiatorState(rng)
 		require.NoError(err, "NewAKEInitiatorState()")
+		require.Zero(rng.Len(), "NewAKEInitiatorState(): Unused entropy")
 		require.Len(stateA.Message, p.AKEInitiatorMessageSize(), "stateA.Message: Length")
 
 		// Create the responder message and shared secret.
-		msgB, ssB := skB.AKEResponderShared(rand.Reader, stateA.Message, pkA)
+		rng = newExactReader(require, p.AKEResponderRandomSize())
+		msgB, ssB := p.AKEResponderShared(rng, stateA.Message, skB, pkA)
+		require.Zero(rng.Len(), "AKEResponderShared(): Unused entropy")
 		require.Len(msgB, p.AKEResponderMessageSize(), "AKEResponderShared(): msgB Length")
 		require.Len(ssB, SymSize, "AKEResponderShared(): ssB Length")
 
+		// A malformed message must be rejected, without using up the state.
+		require.PanicsWithValue(ErrInvalidMessageSize, func() { stateA.Shared(msgB[1:], skA) }, "Shared(): Short")
+		require.PanicsWithValue(ErrInvalidMessageSize, func() { stateA.Shared(append(msgB, 0), skA) }, "Shared(): Long")
+
 		// Create the initiator shared secret.
 		ssA := stateA.Shared(msgB, skA)
 		require.Equal(ssA, ssB, "Shared secret mismatch")
+		require.Equal(make([]byte, SymSize), stateA.tk, "Shared(): tk not wiped")
+
+		// Reusing the initiator state must be rejected.
+		require.PanicsWithValue(ErrStateReused, func() { stateA.Shared(msgB, skA) }, "Shared(): Reuse")
+
+		// Test the transcript capturing variants.
+		stateA, err = pkB.NewAKEInitiatorState(rand.Reader)
+		require.NoError(err, "NewAKEInitiatorState(): Transcript")
+		trB := hashImpl.New256()
+		msgB, ssB = p.AKEResponderSharedWithTranscript(rand.Reader, stateA.Message, skB, pkA, trB)
+		trA := hashImpl.New256()
+		ssA = stateA.SharedWithTranscript(msgB, skA, trA)
+		require.Equal(ssA, ssB, "Shared secret mismatch: Transcript")
+
+		expected := sum256(append(append([]byte{}, stateA.Message...), msgB...))
+		require.Equal(expected[:], trA.Sum(nil), "SharedWithTranscript(): Transcript")
+		require.Equal(expected[:], trB.Sum(nil), "AKEResponderSharedWithTranscript(): Transcript")
+	}
+}
+
+func TestAKEDebug(t *testing.T) {
+	require := require.New(t)
+
+	p := Kyber768
+	pkB, skB, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Responder")
+	pkA, skA, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Initiator")
+
+	stateA, err := pkB.NewAKEInitiatorState(rand.Reader)
+	require.NoError(err, "NewAKEInitiatorState()")
+	msgB, ssB, cB := p.AKEResponderSharedDebug(rand.Reader, stateA.Message, skB, pkA)
+	ssA, cA := stateA.SharedDebug(msgB, skA)
+	require.Equal(ssA, ssB, "Shared secret mismatch")
+	require.Equal(cA, cB, "Contributions mismatch")
+	for _, tk := range [][]byte{cA.Ephemeral, cA.InitiatorStatic, cA.ResponderStatic} {
+		require.Len(tk, SymSize, "Contribution length")
+	}
+
+	// The responder using the wrong initiator long term public key must
+	// only cause the corresponding leg to diverge.
+	pkC, _, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Wrong initiator")
+	stateA, err = pkB.NewAKEInitiatorState(rand.Reader)
+	require.NoError(err, "NewAKEInitiatorState(): Wrong initiator")
+	msgB, ssB, cB = p.AKEResponderSharedDebug(rand.Reader, stateA.Message, skB, pkC)
+	ssA, cA = stateA.SharedDebug(msgB, skA)
+	require.NotEqual(ssA, ssB, "Shared secret match: Wrong initiator")
+	require.Equal(cA.Ephemeral, cB.Ephemeral, "Ephemeral: Wrong initiator")
+	require.NotEqual(cA.InitiatorStatic, cB.InitiatorStatic, "InitiatorStatic: Wrong initiator")
+	require.Equal(cA.ResponderStatic, cB.ResponderStatic, "ResponderStatic: Wrong initiator")
+}
+
+func BenchmarkAKEHandshake(b *testing.B) {
+	forceDisableHardwareAcceleration()
+	doBenchmarkAKEHandshake(b)
+
+	if !canAccelerate {
+		b.Log("Hardware acceleration not supported on this host.")
+		return
+	}
+	mustInitHardwareAcceleration()
+	doBenchmarkAKEHandshake(b)
+}
+
+func doBenchmarkAKEHandshake(b *testing.B) {
+	impl := "_" + hardwareAccelImpl.name
+	for _, p := range allParams {
+		b.Run(p.Name()+impl, func(b *testing.B) { doBenchAKEHandshake(b, p) })
 	}
 }
+
+func doBenchAKEHandshake(b *testing.B, p *ParameterSet) {
+	// The long term static keys are not part of the handshake.
+	pkB, skB, err := p.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		b.Fatalf("GenerateKeyPair(): Responder: %v", err)
+	}
+	pkA, skA, err := p.GenerateKeyPair(rand.Reader)
+	if err != nil {
+		b.Fatalf("GenerateKeyPair(): Initiator: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stateA, err := pkB.NewAKEInitiatorState(rand.Reader)
+		if err != nil {
+			b.Fatalf("NewAKEInitiatorState(): %v", err)
+		}
+		msgB, ssB := p.AKEResponderShared(rand.Reader, stateA.Message, skB, pkA)
+		ssA := stateA.Shared(msgB, skA)
+
+		b.StopTimer()
+		if !bytes.Equal(ssA, ssB) {
+			b.Fatalf("Shared secret mismatch")
+		}
+		b.StartTimer()
+	}
+}
+
+// testDecapsulator is a Decapsulator that stands in for an external (eg:
+// HSM backed) private key.
+type testDecapsulator struct {
+	sk    *PrivateKey
+	calls int
+}
+
+func (d *testDecapsulator) Decapsulate(cipherText []byte) ([]byte, error) {
+	d.calls++
+	return d.sk.Decapsulate(cipherText)
+}
+
+func TestKEXDecapsulator(t *testing.T) {
+	require := require.New(t)
+
+	p := Kyber768
+	pkA, skA, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Initiator")
+	pkB, skB, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Responder")
+	d := &testDecapsulator{sk: skB}
+
+	// UAKE.
+	uake, err := pkB.NewUAKEInitiatorState(rand.Reader)
+	require.NoError(err, "NewUAKEInitiatorState()")
+	msgB, ssB := p.UAKEResponderShared(rand.Reader, uake.Message, d)
+	require.Equal(ssB, uake.Shared(msgB), "UAKEResponderShared(): Shared secret mismatch")
+	require.Equal(1, d.calls, "UAKEResponderShared(): Decapsulate calls")
+
+	// AKE.
+	ake, err := pkB.NewAKEInitiatorState(rand.Reader)
+	require.NoError(err, "NewAKEInitiatorState()")
+	msgB, ssB = p.AKEResponderShared(rand.Reader, ake.Message, d, pkA)
+	require.Equal(ssB, ake.Shared(msgB, skA), "AKEResponderShared(): Shared secret mismatch")
+	require.Equal(2, d.calls, "AKEResponderShared(): Decapsulate calls")
+
+	// PrivateKey.Decapsulate.
+	ss, err := skB.Decapsulate(uake.Message[p.PublicKeySize():])
+	require.NoError(err, "PrivateKey.Decapsulate()")
+	require.Equal(skB.KEMDecrypt(uake.Message[p.PublicKeySize():]), ss, "PrivateKey.Decapsulate()")
+	_, err = skB.Decapsulate(ss)
+	require.Equal(ErrInvalidCipherTextSize, err, "PrivateKey.Decapsulate(): Short")
+
+	// Decapsulator errors must panic.
+	_, skWrong, err := Kyber512.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Kyber512")
+	wrong := &testDecapsulator{sk: skWrong}
+	uake, err = pkB.NewUAKEInitiatorState(rand.Reader)
+	require.NoError(err, "NewUAKEInitiatorState(): Error")
+	require.Panics(func() { p.UAKEResponderShared(rand.Reader, uake.Message, wrong) }, "UAKEResponderShared(): Error")
+}
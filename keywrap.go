@@ -0,0 +1,88 @@
+// keywrap.go - Kyber key transport.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+var (
+	// ErrKeyUnwrap is the error returned when a wrapped key fails to
+	// authenticate, or was wrapped to a different key.
+	ErrKeyUnwrap = errors.New("kyber: key unwrap failed")
+
+	keyWrapDomainSep = []byte("Kyber-KeyWrap")
+)
+
+// A KEM can not transport a caller chosen key, as the shared secret is
+// derived from the encapsulation itself, so it is not possible to re-wrap a
+// KEM cipher text to a different recipient while preserving the shared
+// secret.  Instead, a (content) key is transported by encrypting it with
+// ChaCha20-Poly1305, keyed with SHAKE-256("Kyber-KeyWrap" || ss), under an
+// all-zero nonce (as each KEM shared secret is only used once), with the KEM
+// cipher text as the associated data:
+//
+//	wrapped = ct || ChaCha20-Poly1305(key)
+
+// WrapKey encrypts a caller chosen (content) key to the public key pk.
+func WrapKey(pk *PublicKey, key []byte, rng io.Reader) ([]byte, error) {
+	cipherText, sharedSecret, err := pk.KEMEncrypt(rng)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroize(sharedSecret)
+
+	var nonce [chacha20poly1305.NonceSize]byte
+	aead := newAEAD(keyWrapDomainSep, sharedSecret)
+
+	wrapped := make([]byte, 0, len(cipherText)+len(key)+aeadTagSize)
+	wrapped = append(wrapped, cipherText...)
+
+	return aead.Seal(wrapped, nonce[:], key, cipherText), nil
+}
+
+// UnwrapKey decrypts a key wrapped via WrapKey, with the private key sk.
+func UnwrapKey(sk *PrivateKey, wrapped []byte) ([]byte, error) {
+	ctLen := sk.PublicKey.p.CipherTextSize()
+	if len(wrapped) < ctLen+aeadTagSize {
+		return nil, ErrKeyUnwrap
+	}
+	cipherText := wrapped[:ctLen]
+
+	sharedSecret := sk.KEMDecrypt(cipherText)
+	defer zeroize(sharedSecret)
+
+	var nonce [chacha20poly1305.NonceSize]byte
+	aead := newAEAD(keyWrapDomainSep, sharedSecret)
+
+	key, err := aead.Open(nil, nonce[:], wrapped[ctLen:], cipherText)
+	if err != nil {
+		return nil, ErrKeyUnwrap
+	}
+
+	return key, nil
+}
+
+// ReWrap re-wraps a key wrapped via WrapKey to the private key sk, so that
+// it is instead wrapped to newPk, without returning the key to the caller.
+// The plaintext key is wiped from memory as soon as it is re-wrapped.
+//
+// Note that this operates on the output of WrapKey, and not on bare KEM
+// cipher texts, which can not be re-wrapped (see WrapKey).
+func ReWrap(sk *PrivateKey, wrapped []byte, newPk *PublicKey, rng io.Reader) ([]byte, error) {
+	key, err := UnwrapKey(sk, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroize(key)
+
+	return WrapKey(newPk, key, rng)
+}
@@ -0,0 +1,56 @@
+// keywrap_test.go - Kyber key transport tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyWrap(t *testing.T) {
+	require := require.New(t)
+
+	p := Kyber768
+	pkA, skA, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): A")
+	pkB, skB, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): B")
+
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	require.NoError(err, "rand.Read()")
+
+	wrapped, err := WrapKey(pkA, key, rand.Reader)
+	require.NoError(err, "WrapKey()")
+	require.Len(wrapped, p.CipherTextSize()+len(key)+aeadTagSize, "WrapKey(): Length")
+
+	key2, err := UnwrapKey(skA, wrapped)
+	require.NoError(err, "UnwrapKey()")
+	require.Equal(key, key2, "UnwrapKey(): Key")
+
+	// Re-wrap from A to B.
+	reWrapped, err := ReWrap(skA, wrapped, pkB, rand.Reader)
+	require.NoError(err, "ReWrap()")
+	require.NotEqual(wrapped, reWrapped, "ReWrap(): Unchanged")
+	key2, err = UnwrapKey(skB, reWrapped)
+	require.NoError(err, "UnwrapKey(): Re-wrapped")
+	require.Equal(key, key2, "UnwrapKey(): Re-wrapped key")
+
+	// Failures.
+	_, err = UnwrapKey(skA, reWrapped)
+	require.Equal(ErrKeyUnwrap, err, "UnwrapKey(): Wrong key")
+	_, err = ReWrap(skB, wrapped, pkA, rand.Reader)
+	require.Equal(ErrKeyUnwrap, err, "ReWrap(): Wrong key")
+	_, err = UnwrapKey(skA, wrapped[:p.CipherTextSize()])
+	require.Equal(ErrKeyUnwrap, err, "UnwrapKey(): Truncated")
+	wrapped[len(wrapped)-1] ^= 0x01
+	_, err = UnwrapKey(skA, wrapped)
+	require.Equal(ErrKeyUnwrap, err, "UnwrapKey(): Corrupted")
+}
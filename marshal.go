@@ -0,0 +1,199 @@
+// marshal.go - Kyber self-describing binary serialization.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"encoding"
+	"errors"
+)
+
+const (
+	// marshalVersion is the current binary format version.  The format is
+	// `version || parameter set tag || Bytes()`.
+	marshalVersion = 1
+
+	marshalHeaderSize = 2
+)
+
+var (
+	// ErrUnsupportedVersion is the error returned when a binary marshaled
+	// key has an unknown format version.
+	ErrUnsupportedVersion = errors.New("kyber: unsupported binary format version")
+
+	// ErrInvalidParameterSet is the error returned when a binary marshaled
+	// key has an unknown parameter set tag.
+	ErrInvalidParameterSet = errors.New("kyber: invalid parameter set")
+
+	// ErrAmbiguousParameterSet is the error returned when a key length
+	// matches more than one parameter set.
+	ErrAmbiguousParameterSet = errors.New("kyber: ambiguous parameter set")
+
+	_ encoding.BinaryMarshaler   = (*PublicKey)(nil)
+	_ encoding.BinaryUnmarshaler = (*PublicKey)(nil)
+	_ encoding.BinaryMarshaler   = (*PrivateKey)(nil)
+	_ encoding.BinaryUnmarshaler = (*PrivateKey)(nil)
+	_ encoding.BinaryMarshaler   = (*AKEInitiatorState)(nil)
+	_ encoding.BinaryUnmarshaler = (*AKEInitiatorState)(nil)
+)
+
+// MarshalBinary returns the self-describing binary serialization of a
+// PublicKey, which includes the format version and ParameterSet.
+func (pk *PublicKey) MarshalBinary() ([]byte, error) {
+	return marshalHeader(pk.p, pk.Bytes()), nil
+}
+
+// UnmarshalBinary deserializes a PublicKey serialized via MarshalBinary.
+func (pk *PublicKey) UnmarshalBinary(data []byte) error {
+	p, b, err := unmarshalHeader(data)
+	if err != nil {
+		return err
+	}
+
+	k, err := p.PublicKeyFromBytes(b)
+	if err != nil {
+		return err
+	}
+	*pk = *k
+
+	return nil
+}
+
+// MarshalBinary returns the self-describing binary serialization of a
+// PrivateKey, which includes the format version and ParameterSet.
+func (sk *PrivateKey) MarshalBinary() ([]byte, error) {
+	return marshalHeader(sk.PublicKey.p, sk.Bytes()), nil
+}
+
+// UnmarshalBinary deserializes a PrivateKey serialized via MarshalBinary.
+func (sk *PrivateKey) UnmarshalBinary(data []byte) error {
+	p, b, err := unmarshalHeader(data)
+	if err != nil {
+		return err
+	}
+
+	k, err := p.PrivateKeyFromBytes(b)
+	if err != nil {
+		return err
+	}
+	*sk = *k
+
+	return nil
+}
+
+// MarshalBinary returns the self-describing binary serialization of an
+// AKEInitiatorState, including whether it has been used.
+//
+// WARNING: The serialized state contains the ephemeral private key and the
+// initiator's KEM shared secret, and MUST be treated as secret (eg: stored
+// encrypted and authenticated).
+func (s *AKEInitiatorState) MarshalBinary() ([]byte, error) {
+	p := s.eSk.PublicKey.p
+
+	b := make([]byte, 0, 1+p.PrivateKeySize()+SymSize+p.AKEInitiatorMessageSize())
+	if s.used {
+		b = append(b, 1)
+	} else {
+		b = append(b, 0)
+	}
+	b = append(b, s.eSk.Bytes()...)
+	b = append(b, s.tk...)
+	b = append(b, s.Message...)
+
+	return marshalHeader(p, b), nil
+}
+
+// UnmarshalBinary deserializes an AKEInitiatorState serialized via
+// MarshalBinary.  A state that was used prior to serialization will continue
+// to reject reuse.
+func (s *AKEInitiatorState) UnmarshalBinary(data []byte) error {
+	p, b, err := unmarshalHeader(data)
+	if err != nil {
+		return err
+	}
+	if len(b) != 1+p.PrivateKeySize()+SymSize+p.AKEInitiatorMessageSize() {
+		return ErrInvalidKeySize
+	}
+
+	var used bool
+	switch b[0] {
+	case 0:
+	case 1:
+		used = true
+	default:
+		return ErrInvalidPrivateKey
+	}
+	b = b[1:]
+
+	eSk, err := p.PrivateKeyFromBytes(b[:p.PrivateKeySize()])
+	if err != nil {
+		return err
+	}
+	b = b[p.PrivateKeySize():]
+
+	s.eSk = eSk
+	s.tk = append([]byte{}, b[:SymSize]...)
+	s.Message = append([]byte{}, b[SymSize:]...)
+	s.used = used
+
+	return nil
+}
+
+// GuessParameterSet returns the ParameterSet of an untagged (eg: produced by
+// Bytes, prior to the self-describing format) public or private key, based
+// on the length of the serialized key, which is distinct for each of the
+// supported parameter sets.
+func GuessParameterSet(keyLen int, isPrivate bool) (*ParameterSet, error) {
+	var p *ParameterSet
+	for _, v := range []*ParameterSet{Kyber512, Kyber768, Kyber1024} {
+		sz := v.PublicKeySize()
+		if isPrivate {
+			sz = v.PrivateKeySize()
+		}
+		if sz != keyLen {
+			continue
+		}
+		if p != nil {
+			return nil, ErrAmbiguousParameterSet
+		}
+		p = v
+	}
+	if p == nil {
+		return nil, ErrInvalidKeySize
+	}
+
+	return p, nil
+}
+
+func marshalHeader(p *ParameterSet, b []byte) []byte {
+	out := make([]byte, 0, marshalHeaderSize+len(b))
+	out = append(out, marshalVersion, byte(p.k))
+	return append(out, b...)
+}
+
+func unmarshalHeader(data []byte) (*ParameterSet, []byte, error) {
+	if len(data) < marshalHeaderSize {
+		return nil, nil, ErrInvalidKeySize
+	}
+	if data[0] != marshalVersion {
+		return nil, nil, ErrUnsupportedVersion
+	}
+
+	var p *ParameterSet
+	switch data[1] {
+	case 2:
+		p = Kyber512
+	case 3:
+		p = Kyber768
+	case 4:
+		p = Kyber1024
+	default:
+		return nil, nil, ErrInvalidParameterSet
+	}
+
+	return p, data[marshalHeaderSize:], nil
+}
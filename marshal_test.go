@@ -0,0 +1,107 @@
+// marshal_test.go - Kyber binary serialization tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	for _, p := range allParams {
+		t.Run(p.Name(), func(t *testing.T) { doTestMarshalBinary(t, p) })
+	}
+}
+
+func doTestMarshalBinary(t *testing.T, p *ParameterSet) {
+	require := require.New(t)
+
+	pk, sk, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+
+	b, err := pk.MarshalBinary()
+	require.NoError(err, "pk.MarshalBinary()")
+	var pk2 PublicKey
+	require.NoError(pk2.UnmarshalBinary(b), "pk.UnmarshalBinary()")
+	require.Equal(p, pk2.p, "pk.UnmarshalBinary(): ParameterSet")
+	require.Equal(pk.Bytes(), pk2.Bytes(), "pk.UnmarshalBinary(): Bytes()")
+
+	b, err = sk.MarshalBinary()
+	require.NoError(err, "sk.MarshalBinary()")
+	var sk2 PrivateKey
+	require.NoError(sk2.UnmarshalBinary(b), "sk.UnmarshalBinary()")
+	require.Equal(p, sk2.PublicKey.p, "sk.UnmarshalBinary(): ParameterSet")
+	require.Equal(sk.Bytes(), sk2.Bytes(), "sk.UnmarshalBinary(): Bytes()")
+
+	b[0] = 0xff
+	require.Equal(ErrUnsupportedVersion, sk2.UnmarshalBinary(b), "sk.UnmarshalBinary(): Version 0xFF")
+	b[0] = marshalVersion
+	b[1] = 0xff
+	require.Equal(ErrInvalidParameterSet, sk2.UnmarshalBinary(b), "sk.UnmarshalBinary(): Tag 0xFF")
+
+	require.Equal(ErrInvalidKeySize, pk2.UnmarshalBinary(nil), "pk.UnmarshalBinary(): Truncated")
+}
+
+func TestMarshalAKEInitiatorState(t *testing.T) {
+	require := require.New(t)
+
+	p := Kyber768
+	pkB, skB, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Responder")
+	pkA, skA, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Initiator")
+
+	stateA, err := pkB.NewAKEInitiatorState(rand.Reader)
+	require.NoError(err, "NewAKEInitiatorState()")
+	b, err := stateA.MarshalBinary()
+	require.NoError(err, "MarshalBinary()")
+
+	// Restore the state, as if on a different worker.
+	stateA2 := new(AKEInitiatorState)
+	require.NoError(stateA2.UnmarshalBinary(b), "UnmarshalBinary()")
+	require.Equal(stateA.Message, stateA2.Message, "UnmarshalBinary(): Message")
+
+	msgB, ssB := p.AKEResponderShared(rand.Reader, stateA2.Message, skB, pkA)
+	ssA := stateA2.Shared(msgB, skA)
+	require.Equal(ssA, ssB, "Shared secret mismatch")
+
+	// The used flag must survive serialization.
+	b, err = stateA2.MarshalBinary()
+	require.NoError(err, "MarshalBinary(): Used")
+	stateA3 := new(AKEInitiatorState)
+	require.NoError(stateA3.UnmarshalBinary(b), "UnmarshalBinary(): Used")
+	require.PanicsWithValue(ErrStateReused, func() { stateA3.Shared(msgB, skA) }, "Shared(): Reuse")
+
+	require.Equal(ErrInvalidKeySize, stateA3.UnmarshalBinary(b[:len(b)-1]), "UnmarshalBinary(): Truncated")
+	b[marshalHeaderSize] = 0xff
+	require.Equal(ErrInvalidPrivateKey, stateA3.UnmarshalBinary(b), "UnmarshalBinary(): Invalid used flag")
+}
+
+func TestGuessParameterSet(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range allParams {
+		pk, sk, err := p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "%s: GenerateKeyPair()", p.Name())
+
+		p2, err := GuessParameterSet(len(pk.Bytes()), false)
+		require.NoError(err, "%s: GuessParameterSet(): Public", p.Name())
+		require.Equal(p, p2, "%s: GuessParameterSet(): Public", p.Name())
+
+		p2, err = GuessParameterSet(len(sk.Bytes()), true)
+		require.NoError(err, "%s: GuessParameterSet(): Private", p.Name())
+		require.Equal(p, p2, "%s: GuessParameterSet(): Private", p.Name())
+
+		_, err = GuessParameterSet(len(pk.Bytes()), true)
+		require.Equal(ErrInvalidKeySize, err, "%s: GuessParameterSet(): Public as private", p.Name())
+		_, err = GuessParameterSet(len(sk.Bytes())+1, true)
+		require.Equal(ErrInvalidKeySize, err, "%s: GuessParameterSet(): Bad length", p.Name())
+	}
+}
@@ -0,0 +1,64 @@
+// matrixstats.go - genMatrix rejection sampling statistics.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import "sync/atomic"
+
+var (
+	matrixStatsEnabled bool
+	matrixStats        [5]MatrixStats // Indexed by k.
+)
+
+// MatrixStats is the rejection sampling statistics for public matrix
+// generation.
+type MatrixStats struct {
+	// Entries is the number of matrix entries (polynomials) generated.
+	Entries uint64
+
+	// Accepted is the number of accepted candidate coefficients.
+	Accepted uint64
+
+	// Rejected is the number of rejected candidate coefficients.
+	Rejected uint64
+
+	// Blocks is the number of SHAKE-128 blocks squeezed.
+	Blocks uint64
+}
+
+// EnableMatrixGenStats enables or disables the collection of public matrix
+// generation statistics, and resets the collected statistics.  Collection is
+// disabled by default.
+//
+// This is not safe to call concurrently with any other operation, and
+// SHOULD only be used for performance analysis.
+func EnableMatrixGenStats(enable bool) {
+	matrixStatsEnabled = enable
+	for i := range matrixStats {
+		matrixStats[i] = MatrixStats{}
+	}
+}
+
+// MatrixGenStats returns the public matrix generation statistics collected
+// for the ParameterSet since they were last enabled.
+func MatrixGenStats(p *ParameterSet) MatrixStats {
+	s := &matrixStats[p.k]
+	return MatrixStats{
+		Entries:  atomic.LoadUint64(&s.Entries),
+		Accepted: atomic.LoadUint64(&s.Accepted),
+		Rejected: atomic.LoadUint64(&s.Rejected),
+		Blocks:   atomic.LoadUint64(&s.Blocks),
+	}
+}
+
+func recordMatrixStats(k, blocks, samples int) {
+	s := &matrixStats[k]
+	atomic.AddUint64(&s.Entries, 1)
+	atomic.AddUint64(&s.Accepted, kyberN)
+	atomic.AddUint64(&s.Rejected, uint64(samples-kyberN))
+	atomic.AddUint64(&s.Blocks, uint64(blocks))
+}
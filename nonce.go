@@ -0,0 +1,76 @@
+// nonce.go - AEAD nonce sequences.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const (
+	// NonceSize is the size of a nonce returned by NonceSequence.Next in
+	// bytes, suitable for ChaCha20-Poly1305 and AES-GCM.
+	NonceSize = aeadNonceSize
+
+	nonceSaltSize = 3
+)
+
+var (
+	// ErrNonceExhausted is the error returned when a NonceSequence has no
+	// more nonces.
+	ErrNonceExhausted = errors.New("kyber: nonce sequence exhausted")
+
+	nonceDomainSep = []byte("Kyber-NonceSequence")
+)
+
+// NonceSequence is a monotonic, non-repeating sequence of AEAD nonces,
+// derived from a shared secret.  A NonceSequence is not safe for concurrent
+// use.
+type NonceSequence struct {
+	prefix [NonceSize - 8]byte
+	ctr    uint64
+	done   bool
+}
+
+// Next returns the next nonce in the sequence, or ErrNonceExhausted after
+// 2^64 nonces.
+func (s *NonceSequence) Next() ([]byte, error) {
+	if s.done {
+		return nil, ErrNonceExhausted
+	}
+
+	nonce := make([]byte, NonceSize)
+	copy(nonce, s.prefix[:])
+	binary.BigEndian.PutUint64(nonce[len(s.prefix):], s.ctr)
+
+	if s.ctr == math.MaxUint64 {
+		s.done = true
+	}
+	s.ctr++
+
+	return nonce, nil
+}
+
+// NewNonceSequences derives a pair of NonceSequences from a shared secret,
+// one for each direction of a channel.  The sequences never produce the same
+// nonce, so both directions may use the same key.
+//
+// Each nonce is a 3 byte salt derived from the shared secret with SHAKE-256,
+// a direction byte (0 for the initiator, 1 for the responder), and a 64 bit
+// big endian counter.
+func NewNonceSequences(sharedSecret []byte) (initiator, responder *NonceSequence) {
+	salt := expandSecret(nonceDomainSep, sharedSecret, nil, nonceSaltSize)
+
+	initiator, responder = new(NonceSequence), new(NonceSequence)
+	copy(initiator.prefix[:], salt)
+	copy(responder.prefix[:], salt)
+	responder.prefix[nonceSaltSize] = 1
+
+	return
+}
@@ -0,0 +1,49 @@
+// nonce_test.go - AEAD nonce sequence tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"crypto/rand"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNonceSequence(t *testing.T) {
+	require := require.New(t)
+
+	ss := make([]byte, SymSize)
+	_, err := rand.Read(ss)
+	require.NoError(err, "rand.Read()")
+
+	initiator, responder := NewNonceSequences(ss)
+	initiator2, _ := NewNonceSequences(ss)
+
+	seen := make(map[string]bool)
+	for i := 0; i < nTests; i++ {
+		for _, s := range []*NonceSequence{initiator, responder} {
+			nonce, err := s.Next()
+			require.NoError(err, "Next()")
+			require.Len(nonce, NonceSize, "Next(): Length")
+			require.False(seen[string(nonce)], "Next(): Repeated nonce")
+			seen[string(nonce)] = true
+		}
+
+		nonce, err := initiator2.Next()
+		require.NoError(err, "Next(): Deterministic")
+		require.True(seen[string(nonce)], "Next(): Not deterministic")
+	}
+
+	// Exhaustion must be detected, rather than wrapping.
+	initiator.ctr = math.MaxUint64
+	_, err = initiator.Next()
+	require.NoError(err, "Next(): Last")
+	_, err = initiator.Next()
+	require.Equal(ErrNonceExhausted, err, "Next(): Exhausted")
+}
@@ -0,0 +1,137 @@
+// ntt_test.go - Number-Theoretic Transform tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"math/bits"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// nttKAT is the (fully reduced) output of the reference implementation's
+// ntt() given nttKATInput(), in bitreversed order.
+var nttKAT = [kyberN]uint16{
+	879, 581, 5957, 6333, 5723, 2717, 6992, 69, 4194, 5938, 1654, 2029,
+	5329, 5298, 3252, 6779, 5259, 5571, 3449, 4426, 3996, 2463, 497, 1118,
+	7177, 891, 6598, 4422, 3287, 4251, 6244, 2064, 6196, 5312, 7339, 4775,
+	6603, 1751, 6166, 1379, 7283, 2286, 6058, 1962, 999, 6857, 2572, 7302,
+	152, 3114, 6846, 1135, 3710, 4208, 4701, 7129, 850, 1481, 4194, 4649,
+	1682, 2747, 1551, 4474, 6856, 6333, 4313, 6089, 2333, 720, 6291, 2418,
+	5935, 57, 816, 7440, 3671, 7164, 1989, 1026, 2965, 1055, 2813, 1829,
+	997, 7350, 2655, 3402, 6537, 6098, 7565, 3245, 613, 2797, 5275, 2768,
+	879, 7588, 1931, 3919, 1572, 2019, 1120, 5955, 414, 6849, 2075, 2114,
+	4338, 1499, 4523, 1822, 5530, 3801, 7086, 1003, 5252, 6239, 2587, 5199,
+	2503, 4245, 1514, 5093, 5210, 1738, 4973, 5547, 2174, 2760, 4179, 867,
+	6000, 2554, 5245, 4368, 419, 1072, 3465, 3821, 600, 6232, 1139, 3681,
+	579, 3622, 391, 4374, 5123, 6266, 514, 1811, 6542, 123, 1289, 2279,
+	1063, 4785, 3219, 533, 4423, 5172, 6876, 1895, 469, 4414, 3092, 939,
+	196, 7277, 1133, 592, 4897, 5594, 6148, 7183, 3463, 1399, 143, 6264,
+	1031, 5857, 966, 1100, 929, 2712, 2909, 7129, 7007, 1408, 6549, 4111,
+	5376, 3823, 2996, 6334, 5285, 6595, 1125, 4932, 1934, 1311, 165, 6638,
+	1176, 3063, 7076, 2953, 1127, 4198, 5335, 7061, 6101, 5384, 5222, 2665,
+	7650, 3318, 5855, 5650, 5437, 3241, 5144, 947, 2937, 3506, 4614, 6605,
+	476, 5884, 3154, 2489, 2139, 1624, 5034, 4097, 3987, 268, 6805, 6123,
+	6644, 7644, 1079, 4785, 3140, 2586, 2247, 7164, 4978, 2717, 3813, 6023,
+	3807, 992, 6233, 6596,
+}
+
+func nttKATInput() *[kyberN]uint16 {
+	var p [kyberN]uint16
+	for i := range p {
+		p[i] = uint16((i * 2551) % kyberQ)
+	}
+	return &p
+}
+
+func TestNTT(t *testing.T) {
+	forceDisableHardwareAcceleration()
+	doTestNTT(t)
+
+	if !canAccelerate {
+		t.Log("Hardware acceleration not supported on this host.")
+		return
+	}
+	mustInitHardwareAcceleration()
+	doTestNTT(t)
+}
+
+func doTestNTT(t *testing.T) {
+	impl := "_" + hardwareAccelImpl.name
+	t.Run("KAT"+impl, doTestNTTKAT)
+	t.Run("BitReversal"+impl, doTestNTTBitReversal)
+}
+
+func doTestNTTKAT(t *testing.T) {
+	require := require.New(t)
+
+	var p poly
+	p.coeffs = *nttKATInput()
+
+	p.ntt()
+	for i, v := range p.coeffs {
+		require.Equal(nttKAT[i], freeze(v), "ntt(): coeffs[%d]", i)
+	}
+
+	// The forward transform's output is lazily reduced to an implementation
+	// dependent bound, so the inverse is tested against the fully reduced
+	// known answer, as that's what the rest of the code passes in.
+	p.coeffs = nttKAT
+	p.invntt()
+	for i, v := range p.coeffs {
+		require.Equal(nttKATInput()[i], freeze(v), "invntt(): coeffs[%d]", i)
+	}
+}
+
+func doTestNTTBitReversal(t *testing.T) {
+	require := require.New(t)
+
+	// psi is the smallest primitive 2n-th root of unity mod q, as used to
+	// generate the precomputed tables.
+	powMod := func(b, e uint32) uint16 {
+		r := uint32(1)
+		for ; e > 0; e >>= 1 {
+			if e&1 == 1 {
+				r = (r * b) % kyberQ
+			}
+			b = (b * b) % kyberQ
+		}
+		return uint16(r)
+	}
+	var psi uint32
+	for psi = 2; psi < kyberQ; psi++ {
+		if powMod(psi, kyberN) == kyberQ-1 { // psi^n = -1, so order 2n.
+			break
+		}
+	}
+
+	// Transforming the monomial X^j evaluates it at psi^(2*brv(i)+1), so
+	// output i must be psi^((2*brv(i)+1)*j).
+	for _, j := range []int{0, 1, 2, 3, 17, 128, 200, 255} {
+		var p poly
+		p.coeffs[j] = 1
+
+		p.ntt()
+		for i, v := range p.coeffs {
+			e := (2*uint32(bits.Reverse8(uint8(i))) + 1) * uint32(j)
+			require.Equal(powMod(psi, e%(2*kyberN)), freeze(v), "ntt(X^%d): coeffs[%d]", j, i)
+		}
+
+		for i := range p.coeffs {
+			p.coeffs[i] = freeze(p.coeffs[i])
+		}
+		p.invntt()
+		for i, v := range p.coeffs {
+			var expected uint16
+			if i == j {
+				expected = 1
+			}
+			require.Equal(expected, freeze(v), "invntt(ntt(X^%d)): coeffs[%d]", j, i)
+		}
+	}
+}
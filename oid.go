@@ -0,0 +1,61 @@
+// oid.go - Kyber ASN.1 object identifiers.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"encoding/asn1"
+	"errors"
+)
+
+// ErrUnsupportedOID is the error returned when an ASN.1 object identifier
+// does not correspond to a supported ParameterSet.
+var ErrUnsupportedOID = errors.New("kyber: unsupported OID")
+
+// The draft OIDs assigned to Kyber under the Open Quantum Safe arc.  No
+// OIDs were ever assigned to round 1 Kyber, which this package implements.
+//
+// WARNING: The draft OIDs identify later rounds of the Kyber submission, which
+// are NOT wire compatible with this package, so keys tagged with them will
+// only interoperate with this package, and will be misparsed by other
+// implementations that recognize the same OIDs.
+var (
+	oidKyber512  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 22554, 5, 6, 1}
+	oidKyber768  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 22554, 5, 6, 2}
+	oidKyber1024 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 22554, 5, 6, 3}
+)
+
+// OID returns the ASN.1 object identifier of the ParameterSet, for use in
+// an AlgorithmIdentifier.
+func (p *ParameterSet) OID() asn1.ObjectIdentifier {
+	var oid asn1.ObjectIdentifier
+	switch p.k {
+	case 2:
+		oid = oidKyber512
+	case 3:
+		oid = oidKyber768
+	case 4:
+		oid = oidKyber1024
+	}
+
+	return append(asn1.ObjectIdentifier{}, oid...)
+}
+
+// ParameterSetFromOID returns the ParameterSet corresponding to an ASN.1
+// object identifier.
+func ParameterSetFromOID(oid asn1.ObjectIdentifier) (*ParameterSet, error) {
+	switch {
+	case oid.Equal(oidKyber512):
+		return Kyber512, nil
+	case oid.Equal(oidKyber768):
+		return Kyber768, nil
+	case oid.Equal(oidKyber1024):
+		return Kyber1024, nil
+	}
+
+	return nil, ErrUnsupportedOID
+}
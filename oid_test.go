@@ -0,0 +1,35 @@
+// oid_test.go - Kyber ASN.1 object identifier tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"encoding/asn1"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOID(t *testing.T) {
+	require := require.New(t)
+
+	for i, p := range allParams {
+		oid := p.OID()
+		require.Equal("1.3.6.1.4.1.22554.5.6."+string(rune('1'+i)), oid.String(), "%s: OID()", p.Name())
+
+		p2, err := ParameterSetFromOID(oid)
+		require.NoError(err, "%s: ParameterSetFromOID()", p.Name())
+		require.Equal(p, p2, "%s: ParameterSetFromOID()", p.Name())
+
+		// The returned OID must be a copy.
+		oid[len(oid)-1] = 0
+		require.NotEqual(oid, p.OID(), "%s: OID(): Aliased", p.Name())
+	}
+
+	_, err := ParameterSetFromOID(asn1.ObjectIdentifier{1, 2, 3})
+	require.Equal(ErrUnsupportedOID, err, "ParameterSetFromOID(): Unknown")
+}
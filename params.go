@@ -7,18 +7,41 @@
 
 package kyber
 
+import (
+	"fmt"
+	"sync"
+)
+
 const (
-	// SymSize is the size of the shared key (and certain internal parameters
-	// such as hashes and seeds) in bytes.
+	// SymSize is the size of certain internal parameters such as hashes and
+	// seeds (and currently the shared key, see SharedSecretSize) in bytes.
 	SymSize = 32
 
+	// SharedSecretSize is the size of the shared secret returned by the KEM
+	// and key exchanges in bytes.  This currently equals SymSize, but code
+	// sizing shared secret buffers should use this instead.
+	SharedSecretSize = SymSize
+
+	// MaxCipherTextSize is the size of the largest cipher text of any of the
+	// supported parameter sets (Kyber-1024) in bytes.
+	MaxCipherTextSize = 1504
+
 	kyberN = 256
 	kyberQ = 7681
 
+	// kyberDu and kyberDv are the number of bits per coefficient used to
+	// compress the cipher text polynomial vector b and polynomial v.
+	kyberDu = 11
+	kyberDv = 3
+
 	polySize           = 416
-	polyCompressedSize = 96
+	polyCompressedSize = kyberN * kyberDv / 8
+
+	compressedCoeffSize = kyberN * kyberDu / 8
 
-	compressedCoeffSize = 352
+	x25519Size    = 32
+	aeadNonceSize = 12
+	aeadTagSize   = 16
 )
 
 var (
@@ -50,6 +73,8 @@ type ParameterSet struct {
 
 	k   int
 	eta int
+	du  int
+	dv  int
 
 	polyVecSize           int
 	polyVecCompressedSize int
@@ -62,6 +87,8 @@ type ParameterSet struct {
 	publicKeySize  int
 	secretKeySize  int
 	cipherTextSize int
+
+	scratchPool sync.Pool
 }
 
 // Name returns the name of a given ParameterSet.
@@ -84,6 +111,130 @@ func (p *ParameterSet) CipherTextSize() int {
 	return p.cipherTextSize
 }
 
+// CiphertextCompressionBits returns the number of bits per coefficient used
+// to compress the cipher text polynomial vector (du) and polynomial (dv).
+func (p *ParameterSet) CiphertextCompressionBits() (du, dv int) {
+	return p.du, p.dv
+}
+
+// WireCompatible returns true iff keys and cipher texts serialized under the
+// ParameterSet can be deserialized under other, ie: all of the serialized
+// sizes match, and the serialization is identical.  This does not imply
+// that the algorithms are interoperable (eg: ones that differ only in the
+// choice of symmetric primitives), merely that re-tagging the serialized
+// data is sufficient to parse it.
+func (p *ParameterSet) WireCompatible(other *ParameterSet) bool {
+	if other == nil {
+		return false
+	}
+
+	// The serialization is entirely determined by k and the compression
+	// parameters, but the sizes are compared anyway, for robustness.
+	return p.k == other.k &&
+		p.du == other.du &&
+		p.dv == other.dv &&
+		p.publicKeySize == other.publicKeySize &&
+		p.secretKeySize == other.secretKeySize &&
+		p.cipherTextSize == other.cipherTextSize
+}
+
+// HybridCipherTextSize returns the size of a hybrid cipher text in bytes,
+// consisting of a Kyber cipher text and a X25519 ephemeral public key.
+func (p *ParameterSet) HybridCipherTextSize() int {
+	return p.cipherTextSize + x25519Size
+}
+
+// RecommendedClassicalPairing returns the name of the classical key exchange
+// algorithm of matching strength to pair the ParameterSet with when building
+// a hybrid, following the submission's guidance: "X25519" for Kyber-512 and
+// Kyber-768, and "X448" for Kyber-1024.
+func (p *ParameterSet) RecommendedClassicalPairing() string {
+	if p.k >= 4 {
+		return "X448"
+	}
+	return "X25519"
+}
+
+// SealOverhead returns the size overhead in bytes of sealing a message with
+// a Kyber cipher text and an AEAD with a 96 bit nonce and 128 bit tag (eg:
+// AES-GCM, ChaCha20-Poly1305).
+func (p *ParameterSet) SealOverhead() int {
+	return p.cipherTextSize + aeadNonceSize + aeadTagSize
+}
+
+// KeyGenRandomSize returns the number of bytes of entropy consumed from the
+// io.Reader by GenerateKeyPair.
+func (p *ParameterSet) KeyGenRandomSize() int {
+	return 2 * SymSize
+}
+
+// EncapsulationRandomSize returns the number of bytes of entropy consumed
+// from the io.Reader by KEMEncrypt.
+func (p *ParameterSet) EncapsulationRandomSize() int {
+	return SymSize
+}
+
+// ParameterSizes is the full breakdown of the derived sizes (in bytes, unless
+// noted otherwise) of a ParameterSet.
+type ParameterSizes struct {
+	// K is the number of polynomials in a polynomial vector.
+	K int
+	// Eta is the parameter of the centered binomial noise distribution.
+	Eta int
+	// Du is the cipher text polynomial vector compression bits.
+	Du int
+	// Dv is the cipher text polynomial compression bits.
+	Dv int
+
+	PolyVecSize           int
+	PolyVecCompressedSize int
+
+	IndcpaMsgSize       int
+	IndcpaPublicKeySize int
+	IndcpaSecretKeySize int
+	IndcpaSize          int
+
+	PublicKeySize  int
+	PrivateKeySize int
+	CipherTextSize int
+}
+
+// Sizes returns the full breakdown of the derived sizes of a ParameterSet,
+// for documentation and tooling.
+func (p *ParameterSet) Sizes() ParameterSizes {
+	return ParameterSizes{
+		K:   p.k,
+		Eta: p.eta,
+		Du:  p.du,
+		Dv:  p.dv,
+
+		PolyVecSize:           p.polyVecSize,
+		PolyVecCompressedSize: p.polyVecCompressedSize,
+
+		IndcpaMsgSize:       p.indcpaMsgSize,
+		IndcpaPublicKeySize: p.indcpaPublicKeySize,
+		IndcpaSecretKeySize: p.indcpaSecretKeySize,
+		IndcpaSize:          p.indcpaSize,
+
+		PublicKeySize:  p.publicKeySize,
+		PrivateKeySize: p.secretKeySize,
+		CipherTextSize: p.cipherTextSize,
+	}
+}
+
+// noiseBufferSize returns the number of bytes of SHAKE-256 output consumed
+// per noise polynomial sampled under the ParameterSet.
+func (p *ParameterSet) noiseBufferSize() int {
+	return etaNoiseBufferSize(p.eta)
+}
+
+// maxNoiseNonce returns the largest nonce used to sample a noise polynomial
+// from a single seed under the ParameterSet, by encryption (sp, ep, and
+// epp).  Key generation (skpv and e) uses one fewer.
+func (p *ParameterSet) maxNoiseNonce() int {
+	return 2 * p.k
+}
+
 func newParameterSet(name string, k int) *ParameterSet {
 	var p ParameterSet
 
@@ -100,6 +251,9 @@ func newParameterSet(name string, k int) *ParameterSet {
 		panic("kyber: k must be in {2,3,4}")
 	}
 
+	p.du = kyberDu
+	p.dv = kyberDv
+
 	p.polyVecSize = k * polySize
 	p.polyVecCompressedSize = k * compressedCoeffSize
 
@@ -112,5 +266,52 @@ func newParameterSet(name string, k int) *ParameterSet {
 	p.secretKeySize = p.indcpaSecretKeySize + p.indcpaPublicKeySize + 2*SymSize // 32 bytes of additional space to save H(pk)
 	p.cipherTextSize = p.indcpaSize
 
+	if err := p.validate(); err != nil {
+		panic("kyber: invalid parameter set " + name + ": " + err.Error())
+	}
+
+	p.scratchPool.New = func() interface{} {
+		return p.allocIndcpaScratch()
+	}
+
 	return &p
 }
+
+// validate checks that the derived sizes of a ParameterSet are consistent
+// with each other, so that a misconfigured parameter set fails at
+// construction rather than at runtime.
+func (p *ParameterSet) validate() error {
+	if !isValidEta(p.eta) {
+		return fmt.Errorf("eta is %d, expected one of {3,4,5}", p.eta)
+	}
+
+	// The noise nonce is a single byte, and wrapping would reuse noise.
+	if n := p.maxNoiseNonce(); n > 0xff {
+		return fmt.Errorf("maxNoiseNonce is %d, exceeds a byte", n)
+	}
+
+	for _, v := range []struct {
+		name      string
+		got, want int
+	}{
+		{"polyVecSize", p.polyVecSize, p.k * kyberN * 13 / 8},
+		{"polyVecCompressedSize", p.polyVecCompressedSize, p.k * kyberN * p.du / 8},
+		{"indcpaMsgSize", p.indcpaMsgSize, kyberN / 8},
+		{"indcpaPublicKeySize", p.indcpaPublicKeySize, p.polyVecCompressedSize + SymSize},
+		{"indcpaSecretKeySize", p.indcpaSecretKeySize, p.polyVecSize},
+		{"indcpaSize", p.indcpaSize, p.polyVecCompressedSize + kyberN*p.dv/8},
+		{"publicKeySize", p.publicKeySize, p.indcpaPublicKeySize},
+		{"secretKeySize", p.secretKeySize, p.indcpaSecretKeySize + p.indcpaPublicKeySize + 2*SymSize},
+		{"cipherTextSize", p.cipherTextSize, p.indcpaSize},
+		{"noiseBufferSize", p.noiseBufferSize(), p.eta * kyberN / 4},
+	} {
+		if v.got != v.want {
+			return fmt.Errorf("%s is %d, expected %d", v.name, v.got, v.want)
+		}
+	}
+	if p.cipherTextSize > MaxCipherTextSize {
+		return fmt.Errorf("cipherTextSize is %d, exceeds MaxCipherTextSize", p.cipherTextSize)
+	}
+
+	return nil
+}
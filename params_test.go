@@ -0,0 +1,103 @@
+// params_test.go - Kyber parameterization tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParameterSetSizes(t *testing.T) {
+	require := require.New(t)
+
+	// These MUST match the documented (and specified) sizes.
+	for _, v := range []struct {
+		p                                             *ParameterSet
+		privateKeySize, publicKeySize, cipherTextSize int
+	}{
+		{Kyber512, 1632, 736, 800},
+		{Kyber768, 2400, 1088, 1152},
+		{Kyber1024, 3168, 1440, 1504},
+	} {
+		require.Equal(v.privateKeySize, v.p.PrivateKeySize(), "%s: PrivateKeySize()", v.p.Name())
+		require.Equal(v.publicKeySize, v.p.PublicKeySize(), "%s: PublicKeySize()", v.p.Name())
+		require.Equal(v.cipherTextSize, v.p.CipherTextSize(), "%s: CipherTextSize()", v.p.Name())
+
+		sz := v.p.Sizes()
+		require.Equal(v.privateKeySize, sz.PrivateKeySize, "%s: Sizes().PrivateKeySize", v.p.Name())
+		require.Equal(v.publicKeySize, sz.PublicKeySize, "%s: Sizes().PublicKeySize", v.p.Name())
+		require.Equal(v.cipherTextSize, sz.CipherTextSize, "%s: Sizes().CipherTextSize", v.p.Name())
+		require.Equal(sz.IndcpaSecretKeySize+sz.IndcpaPublicKeySize+2*SymSize, sz.PrivateKeySize, "%s: Sizes(): Private key breakdown", v.p.Name())
+		require.Equal(sz.PolyVecCompressedSize+kyberN*sz.Dv/8, sz.IndcpaSize, "%s: Sizes(): IND-CPA breakdown", v.p.Name())
+		require.Equal(sz.K*polySize, sz.PolyVecSize, "%s: Sizes().PolyVecSize", v.p.Name())
+	}
+
+	require.Equal(32, SharedSecretSize, "SharedSecretSize")
+}
+
+func TestRecommendedClassicalPairing(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("X25519", Kyber512.RecommendedClassicalPairing(), "Kyber512")
+	require.Equal("X25519", Kyber768.RecommendedClassicalPairing(), "Kyber768")
+	require.Equal("X448", Kyber1024.RecommendedClassicalPairing(), "Kyber1024")
+}
+
+func TestWireCompatible(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range allParams {
+		for _, other := range allParams {
+			require.Equal(p == other, p.WireCompatible(other), "%s.WireCompatible(%s)", p.Name(), other.Name())
+		}
+		require.False(p.WireCompatible(nil), "%s.WireCompatible(nil)", p.Name())
+	}
+
+	p := newParameterSet("Kyber-Test", 3)
+	require.True(Kyber768.WireCompatible(p), "WireCompatible(): Identical")
+	p.dv = 4
+	require.False(Kyber768.WireCompatible(p), "WireCompatible(): Different dv")
+}
+
+func TestParameterSetValidate(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range allParams {
+		require.NoError(p.validate(), "%s: validate()", p.Name())
+	}
+
+	p := newParameterSet("Kyber-Test", 3)
+	p.secretKeySize++
+	require.Error(p.validate(), "validate(): Bad secretKeySize")
+
+	p = newParameterSet("Kyber-Test", 3)
+	p.dv = 4
+	require.Error(p.validate(), "validate(): Bad dv")
+
+	p = newParameterSet("Kyber-Test", 3)
+	p.k = 128
+	require.Error(p.validate(), "validate(): Noise nonce overflow")
+}
+
+func TestMaxNoiseNonce(t *testing.T) {
+	require := require.New(t)
+
+	for _, v := range []struct {
+		p        *ParameterSet
+		maxNonce int
+	}{
+		{Kyber512, 4},
+		{Kyber768, 6},
+		{Kyber1024, 8},
+	} {
+		// sp and ep use nonces [0, 2k), and epp uses 2k.
+		require.Equal(v.maxNonce, v.p.maxNoiseNonce(), "%s: maxNoiseNonce()", v.p.Name())
+		require.True(v.p.maxNoiseNonce() < 256, "%s: maxNoiseNonce(): Overflow", v.p.Name())
+	}
+}
@@ -0,0 +1,139 @@
+// pkix.go - Kyber PKIX (DER) serialization.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+)
+
+// ErrInvalidDER is the error returned when a DER encoded key is malformed.
+var ErrInvalidDER = errors.New("kyber: invalid DER encoding")
+
+// subjectPublicKeyInfo is the RFC 5280 SubjectPublicKeyInfo structure.
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// oneAsymmetricKey is the RFC 5958 OneAsymmetricKey (PKCS #8) structure.
+type oneAsymmetricKey struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+	Attributes asn1.RawValue  `asn1:"optional,tag:0"`
+	PublicKey  asn1.BitString `asn1:"optional,tag:1"`
+}
+
+const (
+	pkcs8V1 = 0
+	pkcs8V2 = 1
+)
+
+// MarshalPKIX returns the DER encoded SubjectPublicKeyInfo of a PublicKey,
+// with the ParameterSet's OID (and absent parameters) as the
+// AlgorithmIdentifier, and the byte serialized PublicKey as the BIT STRING.
+func (pk *PublicKey) MarshalPKIX() ([]byte, error) {
+	b := pk.Bytes()
+	return asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm: pk.p.OID(),
+		},
+		PublicKey: asn1.BitString{
+			Bytes:     b,
+			BitLength: 8 * len(b),
+		},
+	})
+}
+
+// ParsePKIXPublicKey deserializes a DER encoded SubjectPublicKeyInfo
+// serialized via MarshalPKIX, with the ParameterSet selected by the OID.
+func ParsePKIXPublicKey(der []byte) (*PublicKey, error) {
+	var spki subjectPublicKeyInfo
+	if rest, err := asn1.Unmarshal(der, &spki); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, ErrInvalidDER
+	}
+
+	p, err := parseAlgorithmIdentifier(&spki.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if spki.PublicKey.BitLength != 8*len(spki.PublicKey.Bytes) {
+		return nil, ErrInvalidDER
+	}
+
+	return p.PublicKeyFromBytes(spki.PublicKey.Bytes)
+}
+
+// MarshalPKCS8 returns the DER encoded OneAsymmetricKey (PKCS #8 v2) of a
+// PrivateKey, with the ParameterSet's OID (and absent parameters) as the
+// AlgorithmIdentifier, the byte serialized PrivateKey as the privateKey
+// OCTET STRING, and the byte serialized PublicKey as the publicKey.
+func (sk *PrivateKey) MarshalPKCS8() ([]byte, error) {
+	pkBytes := sk.PublicKey.Bytes()
+	return asn1.Marshal(oneAsymmetricKey{
+		Version: pkcs8V2,
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm: sk.PublicKey.p.OID(),
+		},
+		PrivateKey: sk.Bytes(),
+		PublicKey: asn1.BitString{
+			Bytes:     pkBytes,
+			BitLength: 8 * len(pkBytes),
+		},
+	})
+}
+
+// ParsePKCS8PrivateKey deserializes a DER encoded OneAsymmetricKey (PKCS #8)
+// serialized via MarshalPKCS8, with the ParameterSet selected by the OID.
+// The PublicKey and H(pk) embedded in the private key are checked for
+// consistency, as is the optional publicKey field, if present.
+func ParsePKCS8PrivateKey(der []byte) (*PrivateKey, error) {
+	var oak oneAsymmetricKey
+	if rest, err := asn1.Unmarshal(der, &oak); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, ErrInvalidDER
+	}
+
+	if oak.Version != pkcs8V1 && oak.Version != pkcs8V2 {
+		return nil, ErrInvalidDER
+	}
+	p, err := parseAlgorithmIdentifier(&oak.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	sk, err := p.PrivateKeyFromBytes(oak.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if oak.PublicKey.BitLength != 0 {
+		if oak.Version != pkcs8V2 || oak.PublicKey.BitLength != 8*len(oak.PublicKey.Bytes) {
+			return nil, ErrInvalidDER
+		}
+		if !bytes.Equal(oak.PublicKey.Bytes, sk.PublicKey.Bytes()) {
+			return nil, ErrInvalidPrivateKey
+		}
+	}
+
+	return sk, nil
+}
+
+func parseAlgorithmIdentifier(ai *pkix.AlgorithmIdentifier) (*ParameterSet, error) {
+	// Like Ed25519 (RFC 8410), the parameters MUST be absent.
+	if len(ai.Parameters.FullBytes) != 0 {
+		return nil, ErrInvalidDER
+	}
+
+	return ParameterSetFromOID(ai.Algorithm)
+}
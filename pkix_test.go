@@ -0,0 +1,97 @@
+// pkix_test.go - Kyber PKIX (DER) serialization tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKIX(t *testing.T) {
+	for _, p := range allParams {
+		t.Run(p.Name(), func(t *testing.T) { doTestPKIX(t, p) })
+	}
+}
+
+func doTestPKIX(t *testing.T, p *ParameterSet) {
+	require := require.New(t)
+
+	pk, _, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+
+	der, err := pk.MarshalPKIX()
+	require.NoError(err, "MarshalPKIX()")
+	pk2, err := ParsePKIXPublicKey(der)
+	require.NoError(err, "ParsePKIXPublicKey()")
+	require.Equal(p, pk2.p, "ParsePKIXPublicKey(): ParameterSet")
+	require.Equal(pk.Bytes(), pk2.Bytes(), "ParsePKIXPublicKey(): Bytes()")
+
+	_, err = ParsePKIXPublicKey(append(der, 0))
+	require.Equal(ErrInvalidDER, err, "ParsePKIXPublicKey(): Trailing data")
+	_, err = ParsePKIXPublicKey(der[:len(der)-1])
+	require.Error(err, "ParsePKIXPublicKey(): Truncated")
+}
+
+func TestPKCS8(t *testing.T) {
+	for _, p := range allParams {
+		t.Run(p.Name(), func(t *testing.T) { doTestPKCS8(t, p) })
+	}
+}
+
+func doTestPKCS8(t *testing.T, p *ParameterSet) {
+	require := require.New(t)
+
+	_, sk, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+
+	der, err := sk.MarshalPKCS8()
+	require.NoError(err, "MarshalPKCS8()")
+	sk2, err := ParsePKCS8PrivateKey(der)
+	require.NoError(err, "ParsePKCS8PrivateKey()")
+	requirePrivateKeyEqual(require, sk, sk2)
+	require.Equal(sk.Bytes(), sk2.Bytes(), "ParsePKCS8PrivateKey(): Bytes()")
+
+	// A v1 encoding (without the publicKey field) must also be accepted.
+	oak := oneAsymmetricKey{
+		Version:    pkcs8V1,
+		Algorithm:  pkix.AlgorithmIdentifier{Algorithm: p.OID()},
+		PrivateKey: sk.Bytes(),
+	}
+	der, err = asn1.Marshal(oak)
+	require.NoError(err, "asn1.Marshal(): v1")
+	sk2, err = ParsePKCS8PrivateKey(der)
+	require.NoError(err, "ParsePKCS8PrivateKey(): v1")
+	requirePrivateKeyEqual(require, sk, sk2)
+
+	// A mismatched publicKey must be rejected.
+	pk3, _, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Mismatched")
+	oak.Version = pkcs8V2
+	oak.PublicKey = asn1.BitString{Bytes: pk3.Bytes(), BitLength: 8 * p.PublicKeySize()}
+	der, err = asn1.Marshal(oak)
+	require.NoError(err, "asn1.Marshal(): Mismatched")
+	_, err = ParsePKCS8PrivateKey(der)
+	require.Equal(ErrInvalidPrivateKey, err, "ParsePKCS8PrivateKey(): Mismatched publicKey")
+
+	// A corrupted H(pk) must be rejected.
+	b := sk.Bytes()
+	b[len(b)-2*SymSize] ^= 0x01
+	oak = oneAsymmetricKey{
+		Version:    pkcs8V1,
+		Algorithm:  pkix.AlgorithmIdentifier{Algorithm: p.OID()},
+		PrivateKey: b,
+	}
+	der, err = asn1.Marshal(oak)
+	require.NoError(err, "asn1.Marshal(): Corrupted")
+	_, err = ParsePKCS8PrivateKey(der)
+	require.Equal(ErrPublicKeyHashMismatch, err, "ParsePKCS8PrivateKey(): Corrupted H(pk)")
+}
@@ -7,8 +7,6 @@
 
 package kyber
 
-import "golang.org/x/crypto/sha3"
-
 // Elements of R_q = Z_q[X]/(X^n + 1). Represents polynomial coeffs[0] +
 // X*coeffs[1] + X^2*xoeffs[2] + ... + X^{n-1}*coeffs[n-1].
 type poly struct {
@@ -105,6 +103,13 @@ func (p *poly) toMsg(msg []byte) {
 	}
 }
 
+// Zero all coefficients of a polynomial.
+func (p *poly) reset() {
+	for i := range p.coeffs {
+		p.coeffs[i] = 0
+	}
+}
+
 // Sample a polynomial deterministically from a seed and a nonce, with output
 // polynomial close to centered binomial distribution with parameter eta.
 func (p *poly) getNoise(seed []byte, nonce byte, eta int) {
@@ -112,12 +117,66 @@ func (p *poly) getNoise(seed []byte, nonce byte, eta int) {
 	extSeed = append(extSeed, seed...)
 	extSeed = append(extSeed, nonce)
 
-	buf := make([]byte, eta*kyberN/4)
-	sha3.ShakeSum256(buf, extSeed)
+	buf := make([]byte, etaNoiseBufferSize(eta))
+	shakeSum256(buf, extSeed)
 
 	p.cbd(buf, eta)
 }
 
+// isValidEta returns true iff eta is supported by the centered binomial
+// sampler (cbd).
+func isValidEta(eta int) bool {
+	switch eta {
+	case 3, 4, 5:
+		return true
+	default:
+		return false
+	}
+}
+
+// etaNoiseBufferSize returns the number of bytes of SHAKE-256 output that
+// cbd consumes to sample a polynomial with parameter eta, ie: 2*eta bits per
+// coefficient.
+func etaNoiseBufferSize(eta int) int {
+	return eta * kyberN / 4
+}
+
+// Poly is an element of R_q = Z_q[X]/(X^256 + 1), with each coefficient
+// fully reduced to [0, q).
+type Poly [kyberN]uint16
+
+// SampleNoise deterministically samples a polynomial from a SymSize byte
+// seed and a nonce, with coefficients distributed according to a centered
+// binomial distribution with parameter eta, using the same sampler as the
+// KEM itself.
+//
+// Providing an eta that is not in {3,4,5}, or an invalid seed length will
+// result in a panic.
+func SampleNoise(seed []byte, nonce byte, eta int) *Poly {
+	if !isValidEta(eta) {
+		panic("kyber: eta must be in {3,4,5}")
+	}
+	if len(seed) != SymSize {
+		panic("kyber: seed must be SymSize bytes")
+	}
+
+	var p poly
+	p.getNoise(seed, nonce, eta)
+
+	return p.export()
+}
+
+// Convert a polynomial to the exported representation, with each
+// coefficient fully reduced.
+func (p *poly) export() *Poly {
+	r := new(Poly)
+	for i, c := range p.coeffs {
+		r[i] = freeze(c)
+	}
+
+	return r
+}
+
 // Computes negacyclic number-theoretic transform (NTT) of a polynomial in
 // place; inputs assumed to be in normal order, output in bitreversed order.
 func (p *poly) ntt() {
@@ -0,0 +1,243 @@
+// poly_test.go - Kyber polynomial tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampleNoise(t *testing.T) {
+	require := require.New(t)
+
+	var seed [SymSize]byte
+	_, err := rand.Read(seed[:])
+	require.NoError(err, "rand.Read()")
+
+	for _, eta := range []int{3, 4, 5} {
+		for nonce := 0; nonce < 4; nonce++ {
+			r := SampleNoise(seed[:], byte(nonce), eta)
+
+			var p poly
+			p.getNoise(seed[:], byte(nonce), eta)
+			for i, c := range r {
+				require.Equal(freeze(p.coeffs[i]), c, "eta %d: Coefficient %d", eta, i)
+
+				// The centered value must be in [-eta, eta].
+				require.True(c <= uint16(eta) || c >= kyberQ-uint16(eta), "eta %d: Coefficient %d out of range: %d", eta, i, c)
+			}
+		}
+	}
+
+	require.Panics(func() { SampleNoise(seed[:], 0, 2) }, "SampleNoise(): eta = 2")
+	require.Panics(func() { SampleNoise(seed[:1], 0, 3) }, "SampleNoise(): Short seed")
+}
+
+func TestNoiseBufferSize(t *testing.T) {
+	require := require.New(t)
+
+	for _, eta := range []int{3, 4, 5} {
+		require.True(isValidEta(eta), "isValidEta(%d)", eta)
+		require.Equal(eta*kyberN/4, etaNoiseBufferSize(eta), "etaNoiseBufferSize(%d)", eta)
+
+		// cbd consumes exactly 2*eta bits per coefficient.
+		require.Equal(2*eta*kyberN, 8*etaNoiseBufferSize(eta), "etaNoiseBufferSize(%d): cbd", eta)
+	}
+	for _, eta := range []int{0, 1, 2, 6} {
+		require.False(isValidEta(eta), "isValidEta(%d)", eta)
+	}
+
+	for _, p := range allParams {
+		require.Equal(p.eta*kyberN/4, p.noiseBufferSize(), "%s: noiseBufferSize()", p.Name())
+	}
+}
+
+func TestScratchReset(t *testing.T) {
+	require := require.New(t)
+
+	p := Kyber768
+	s := p.getScratch()
+	secret := []polyVec{s.skpv, s.sp, s.ep, s.bp, {[]*poly{&s.v, &s.mp, &s.epp}}}
+	for _, v := range secret {
+		for _, pv := range v.vec {
+			for i := range pv.coeffs {
+				pv.coeffs[i] = uint16(i) + 1
+			}
+		}
+	}
+	for _, b := range [][]byte{s.cmp, s.extSeed[:], s.noise} {
+		for i := range b {
+			b[i] = 0xa5
+		}
+	}
+	p.putScratch(s)
+
+	// Inspect the returned object directly, as the pool is free to discard
+	// it, and to return a different (freshly allocated) object from Get.
+	//
+	// pkpv and at are public, and deliberately not reset.
+	for _, v := range secret {
+		for _, pv := range v.vec {
+			for i, c := range pv.coeffs {
+				require.Zero(c, "Coefficient %d not reset", i)
+			}
+		}
+	}
+	require.Equal(make([]byte, p.CipherTextSize()), s.cmp, "cmp not reset")
+	require.Equal(make([]byte, SymSize+1), s.extSeed[:], "extSeed not reset")
+	require.Equal(make([]byte, etaNoiseBufferSize(p.eta)), s.noise, "noise not reset")
+}
+
+func TestScratchGetNoise(t *testing.T) {
+	require := require.New(t)
+
+	var seed [SymSize]byte
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+
+	for _, p := range allParams {
+		s := p.getScratch()
+		for nonce := byte(0); nonce < 4; nonce++ {
+			var a, b poly
+			a.getNoise(seed[:], nonce, p.eta)
+			s.getNoise(&b, seed[:], nonce, p.eta)
+			require.Equal(a, b, "%s: nonce %d", p.Name(), nonce)
+		}
+		p.putScratch(s)
+	}
+}
+
+// refCompress is a straightforward reference implementation of compression
+// to d bits, round(2^d / q * x) mod 2^d, packed little-endian, least
+// significant bit first.
+func refCompress(coeffs []uint16, d uint) []byte {
+	r := make([]byte, len(coeffs)*int(d)/8)
+	for i, x := range coeffs {
+		y := uint(math.Round(float64(x)*float64(uint(1)<<d)/kyberQ)) % (1 << d)
+		for b := uint(0); b < d; b++ {
+			bit := uint(i)*d + b
+			r[bit/8] |= byte((y>>b)&1) << (bit % 8)
+		}
+	}
+	return r
+}
+
+// refDecompress is a straightforward reference implementation of
+// decompression from d bits, round(q / 2^d * y), the approximate inverse of
+// refCompress.
+func refDecompress(a []byte, n int, d uint) []uint16 {
+	coeffs := make([]uint16, n)
+	for i := range coeffs {
+		var y uint
+		for b := uint(0); b < d; b++ {
+			bit := uint(i)*d + b
+			y |= uint((a[bit/8]>>(bit%8))&1) << b
+		}
+		coeffs[i] = uint16(math.Round(float64(y) * kyberQ / float64(uint(1)<<d)))
+	}
+	return coeffs
+}
+
+func TestCompressReference(t *testing.T) {
+	require := require.New(t)
+
+	const nSamples = 1000
+
+	var rnd [2]byte
+	randCoeff := func() uint16 {
+		_, err := rand.Read(rnd[:])
+		require.NoError(err, "rand.Read()")
+		return uint16(binary.LittleEndian.Uint16(rnd[:]) % kyberQ)
+	}
+
+	for i := 0; i < nSamples; i++ {
+		// poly (3 bit) compression.
+		var p poly
+		for j := range p.coeffs {
+			p.coeffs[j] = randCoeff()
+		}
+		b := make([]byte, polyCompressedSize)
+		p.compress(b)
+		require.Equal(refCompress(p.coeffs[:], kyberDv), b, "poly.compress()")
+
+		_, err := rand.Read(b)
+		require.NoError(err, "rand.Read()")
+		p.decompress(b)
+		require.Equal(refDecompress(b, kyberN, kyberDv), p.coeffs[:], "poly.decompress()")
+
+		// polyVec (11 bit) compression.
+		v := Kyber768.allocPolyVec()
+		var coeffs []uint16
+		for _, pv := range v.vec {
+			for j := range pv.coeffs {
+				pv.coeffs[j] = randCoeff()
+			}
+			coeffs = append(coeffs, pv.coeffs[:]...)
+		}
+		b = make([]byte, v.compressedSize())
+		v.compress(b)
+		require.Equal(refCompress(coeffs, kyberDu), b, "polyVec.compress()")
+
+		_, err = rand.Read(b)
+		require.NoError(err, "rand.Read()")
+		v.decompress(b)
+		coeffs = coeffs[:0]
+		for _, pv := range v.vec {
+			coeffs = append(coeffs, pv.coeffs[:]...)
+		}
+		require.Equal(refDecompress(b, len(coeffs), kyberDu), coeffs, "polyVec.decompress()")
+	}
+}
+
+func TestPolyBytesRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	const nSamples = 1000
+
+	var rnd [2]byte
+	randCoeff := func() uint16 {
+		_, err := rand.Read(rnd[:])
+		require.NoError(err, "rand.Read()")
+		return uint16(binary.LittleEndian.Uint16(rnd[:]) % kyberQ)
+	}
+
+	b, b2 := make([]byte, polySize), make([]byte, polySize)
+	for i := 0; i < nSamples; i++ {
+		var p, p2 poly
+		for j := range p.coeffs {
+			p.coeffs[j] = randCoeff()
+		}
+		if i == 0 {
+			// Exercise the extremes explicitly.
+			for j := range p.coeffs {
+				p.coeffs[j] = uint16(j&1) * (kyberQ - 1)
+			}
+		}
+
+		p.toBytes(b)
+		p2.fromBytes(b)
+		for j, c := range p.coeffs {
+			require.Equal(c, freeze(p2.coeffs[j]), "fromBytes(): Coefficient %d", j)
+		}
+		p2.toBytes(b2)
+		require.Equal(b, b2, "toBytes(): Round trip")
+
+		// Unreduced coefficients must serialize identically to their
+		// canonical representatives.
+		for j := range p2.coeffs {
+			p2.coeffs[j] += kyberQ
+		}
+		p2.toBytes(b2)
+		require.Equal(b, b2, "toBytes(): Unreduced")
+	}
+}
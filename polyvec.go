@@ -96,6 +96,13 @@ func (v *polyVec) add(a, b *polyVec) {
 	}
 }
 
+// Zero all coefficients of a vector of polynomials.
+func (v *polyVec) reset() {
+	for _, p := range v.vec {
+		p.reset()
+	}
+}
+
 // Get compressed and serialized size in bytes.
 func (v *polyVec) compressedSize() int {
 	return len(v.vec) * compressedCoeffSize
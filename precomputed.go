@@ -0,0 +1,168 @@
+// precomputed.go - Kyber precomputed public keys.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"encoding"
+	"io"
+)
+
+var (
+	_ encoding.BinaryMarshaler   = (*PrecomputedPublicKey)(nil)
+	_ encoding.BinaryUnmarshaler = (*PrecomputedPublicKey)(nil)
+)
+
+// PrecomputedPublicKey is a PublicKey with the NTT domain public key
+// polynomial vector and the (transposed) matrix cached, to speed up repeated
+// encapsulation to the same public key.
+type PrecomputedPublicKey struct {
+	pk *PublicKey
+
+	pkpv polyVec
+	at   []polyVec
+}
+
+// Precompute returns a PrecomputedPublicKey for a given PublicKey.
+func (pk *PublicKey) Precompute() (*PrecomputedPublicKey, error) {
+	var seed [SymSize]byte
+
+	p := pk.p
+	ppk := &PrecomputedPublicKey{
+		pk:   pk,
+		pkpv: p.allocPolyVec(),
+		at:   p.allocMatrix(),
+	}
+	unpackPublicKey(&ppk.pkpv, seed[:], pk.pk.packed)
+	ppk.pkpv.ntt()
+	if err := genMatrix(ppk.at, seed[:], true); err != nil {
+		return nil, err
+	}
+
+	return ppk, nil
+}
+
+// PublicKey returns the PublicKey corresponding to a PrecomputedPublicKey.
+func (ppk *PrecomputedPublicKey) PublicKey() *PublicKey {
+	return ppk.pk
+}
+
+// KEMEncrypt generates cipher text and shared secret via the CCA-secure Kyber
+// key encapsulation mechanism, and is otherwise identical to
+// PublicKey.KEMEncrypt.
+func (ppk *PrecomputedPublicKey) KEMEncrypt(rng io.Reader) (cipherText []byte, sharedSecret []byte, err error) {
+	return ppk.pk.kemEncrypt(rng, true, ppk)
+}
+
+// EncapsulationContext is a session-scoped context for repeated encapsulation
+// to the same PublicKey (eg: periodic rekeying), that caches the NTT domain
+// public key polynomial vector and the transposed matrix on first use.
+//
+// The cache is (1 + k) * k polynomials (3 KiB for Kyber-512, 6 KiB for
+// Kyber-768, and 10 KiB for Kyber-1024), and is retained until Close is
+// called or the EncapsulationContext becomes unreachable.  The cached values
+// are derived from the public key, and are not secret.
+//
+// An EncapsulationContext is not safe for concurrent use.
+type EncapsulationContext struct {
+	pk  *PublicKey
+	ppk *PrecomputedPublicKey
+}
+
+// NewEncapsulationContext returns a new EncapsulationContext for a PublicKey.
+func (pk *PublicKey) NewEncapsulationContext() *EncapsulationContext {
+	return &EncapsulationContext{pk: pk}
+}
+
+// Encapsulate is PublicKey.Encapsulate, except that the cached NTT domain
+// public key and transposed matrix are reused (and generated if required).
+func (ctx *EncapsulationContext) Encapsulate(rng io.Reader) (*Encapsulation, error) {
+	if ctx.ppk == nil {
+		ppk, err := ctx.pk.Precompute()
+		if err != nil {
+			return nil, err
+		}
+		ctx.ppk = ppk
+	}
+
+	cipherText, ss, err := ctx.ppk.KEMEncrypt(rng)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroize(ss)
+
+	e := &Encapsulation{
+		CipherText:   cipherText,
+		SharedSecret: new(SharedSecret),
+	}
+	copy(e.SharedSecret[:], ss)
+
+	return e, nil
+}
+
+// Close releases the cache of an EncapsulationContext at the end of a
+// session.  Subsequent calls to Encapsulate will regenerate it.
+func (ctx *EncapsulationContext) Close() {
+	ctx.ppk = nil
+}
+
+// MarshalBinary returns the self-describing binary serialization of a
+// PrecomputedPublicKey, which includes the format version, ParameterSet,
+// public key, and the cached values.
+//
+// The cached values are derived from the public key, and are not secret,
+// however UnmarshalBinary can not cheaply check that they are consistent
+// with the public key, so the serialized form MUST be stored such that it
+// can not be tampered with.
+func (ppk *PrecomputedPublicKey) MarshalBinary() ([]byte, error) {
+	p := ppk.pk.p
+
+	b := make([]byte, p.publicKeySize+(1+p.k)*p.polyVecSize)
+	copy(b, ppk.pk.Bytes())
+	off := p.publicKeySize
+	for _, v := range append([]polyVec{ppk.pkpv}, ppk.at...) {
+		v.toBytes(b[off:])
+		off += p.polyVecSize
+	}
+
+	return marshalHeader(p, b), nil
+}
+
+// UnmarshalBinary deserializes a PrecomputedPublicKey serialized via
+// MarshalBinary.
+func (ppk *PrecomputedPublicKey) UnmarshalBinary(data []byte) error {
+	p, b, err := unmarshalHeader(data)
+	if err != nil {
+		return err
+	}
+	if len(b) != p.publicKeySize+(1+p.k)*p.polyVecSize {
+		return ErrInvalidKeySize
+	}
+
+	pk, err := p.PublicKeyFromBytes(b[:p.publicKeySize])
+	if err != nil {
+		return err
+	}
+	b = b[p.publicKeySize:]
+
+	pkpv, at := p.allocPolyVec(), p.allocMatrix()
+	for _, v := range append([]polyVec{pkpv}, at...) {
+		v.fromBytes(b)
+		for _, pv := range v.vec {
+			for _, c := range pv.coeffs {
+				if c >= kyberQ {
+					return ErrInvalidPublicKey
+				}
+			}
+		}
+		b = b[p.polyVecSize:]
+	}
+
+	ppk.pk, ppk.pkpv, ppk.at = pk, pkpv, at
+
+	return nil
+}
@@ -0,0 +1,122 @@
+// precomputed_test.go - Kyber precomputed public key tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrecomputedPublicKey(t *testing.T) {
+	for _, p := range allParams {
+		t.Run(p.Name(), func(t *testing.T) { doTestPrecomputedPublicKey(t, p) })
+	}
+}
+
+func doTestPrecomputedPublicKey(t *testing.T, p *ParameterSet) {
+	require := require.New(t)
+
+	pk, sk, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+
+	ppk, err := pk.Precompute()
+	require.NoError(err, "Precompute()")
+	require.Equal(pk, ppk.PublicKey(), "PublicKey()")
+
+	b, err := ppk.MarshalBinary()
+	require.NoError(err, "MarshalBinary()")
+	ppk2 := new(PrecomputedPublicKey)
+	require.NoError(ppk2.UnmarshalBinary(b), "UnmarshalBinary()")
+	requirePublicKeyEqual(require, pk, ppk2.PublicKey())
+
+	coins := make([]byte, p.EncapsulationRandomSize())
+	for i := 0; i < nTests; i++ {
+		_, err = rand.Read(coins)
+		require.NoError(err, "rand.Read()")
+
+		ct, ss, err := pk.KEMEncrypt(bytes.NewReader(coins))
+		require.NoError(err, "KEMEncrypt()")
+		ct2, ss2, err := ppk.KEMEncrypt(bytes.NewReader(coins))
+		require.NoError(err, "Precompute().KEMEncrypt()")
+		ct3, ss3, err := ppk2.KEMEncrypt(bytes.NewReader(coins))
+		require.NoError(err, "UnmarshalBinary().KEMEncrypt()")
+
+		require.Equal(ct, ct2, "Precompute().KEMEncrypt(): ct")
+		require.Equal(ss, ss2, "Precompute().KEMEncrypt(): ss")
+		require.Equal(ct, ct3, "UnmarshalBinary().KEMEncrypt(): ct")
+		require.Equal(ss, ss3, "UnmarshalBinary().KEMEncrypt(): ss")
+		require.Equal(ss, sk.KEMDecrypt(ct3), "KEMDecrypt()")
+	}
+
+	require.Equal(ErrInvalidKeySize, ppk2.UnmarshalBinary(b[:len(b)-1]), "UnmarshalBinary(): Truncated")
+	b[len(b)-1] = 0xff // Top bits of the last coefficient, >= q.
+	require.Equal(ErrInvalidPublicKey, ppk2.UnmarshalBinary(b), "UnmarshalBinary(): Unreduced coefficient")
+}
+
+func TestEncapsulationContext(t *testing.T) {
+	require := require.New(t)
+
+	for _, p := range allParams {
+		pk, sk, err := p.GenerateKeyPair(rand.Reader)
+		require.NoError(err, "%s: GenerateKeyPair()", p.Name())
+
+		ctx := pk.NewEncapsulationContext()
+		coins := make([]byte, p.EncapsulationRandomSize())
+		for i := 0; i < nTests; i++ {
+			_, err = rand.Read(coins)
+			require.NoError(err, "rand.Read()")
+
+			e, err := pk.Encapsulate(bytes.NewReader(coins))
+			require.NoError(err, "%s: Encapsulate()", p.Name())
+			e2, err := ctx.Encapsulate(bytes.NewReader(coins))
+			require.NoError(err, "%s: EncapsulationContext.Encapsulate()", p.Name())
+			require.NotNil(ctx.ppk, "%s: EncapsulationContext.Encapsulate(): Cache", p.Name())
+
+			require.Equal(e.CipherText, e2.CipherText, "%s: EncapsulationContext.Encapsulate(): ct", p.Name())
+			require.True(e.SharedSecret.Equal(e2.SharedSecret), "%s: EncapsulationContext.Encapsulate(): ss", p.Name())
+			require.Equal(e2.SharedSecret[:], sk.KEMDecrypt(e2.CipherText), "%s: KEMDecrypt()", p.Name())
+
+			if i == nTests/2 {
+				ctx.Close()
+				require.Nil(ctx.ppk, "%s: Close()", p.Name())
+			}
+		}
+
+		_, err = ctx.Encapsulate(nil)
+		require.Equal(ErrNilRandomSource, err, "%s: EncapsulationContext.Encapsulate(nil)", p.Name())
+	}
+}
+
+func BenchmarkEncapsulationContext(b *testing.B) {
+	for _, p := range allParams {
+		pk, _, err := p.GenerateKeyPair(rand.Reader)
+		if err != nil {
+			b.Fatalf("GenerateKeyPair(): %v", err)
+		}
+
+		b.Run(p.Name()+"_PublicKey", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := pk.Encapsulate(rand.Reader); err != nil {
+					b.Fatalf("Encapsulate(): %v", err)
+				}
+			}
+		})
+		b.Run(p.Name()+"_EncapsulationContext", func(b *testing.B) {
+			ctx := pk.NewEncapsulationContext()
+			defer ctx.Close()
+			for i := 0; i < b.N; i++ {
+				if _, err := ctx.Encapsulate(rand.Reader); err != nil {
+					b.Fatalf("EncapsulationContext.Encapsulate(): %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+// race_disabled_test.go - Race detector build flag (disabled).
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// +build !race
+
+package kyber
+
+// The race detector makes sync.Pool randomly drop objects, so allocation
+// counts are only meaningful without it.
+const raceEnabled = false
@@ -32,6 +32,10 @@ func barrettReduce(a uint16) uint16 {
 }
 
 // Full reduction; given a 16-bit integer a, computes unsigned integer a mod q.
+//
+// This is branchless.  As r is in {0,...,11768}, m = r - q is in
+// {-7681,...,4087} when interpreted as an int16, so the arithmetic shift
+// yields an all ones mask iff r < q, which selects r over m.
 func freeze(x uint16) uint16 {
 	r := barrettReduce(x)
 
@@ -0,0 +1,163 @@
+// reduce_test.go - Kyber modular reduction tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeze(t *testing.T) {
+	require := require.New(t)
+
+	// Inputs near the q boundary, and the maximum barrettReduce output.
+	for _, v := range []struct {
+		x, expected uint16
+	}{
+		{0, 0},
+		{kyberQ - 1, kyberQ - 1},
+		{kyberQ, 0},
+		{kyberQ + 1, 1},
+		{2*kyberQ - 1, kyberQ - 1},
+		{2 * kyberQ, 0},
+		{2*kyberQ + 1, 1},
+		{11768, 11768 - kyberQ},
+		{0xffff, 0xffff % kyberQ},
+	} {
+		require.Equal(v.expected, freeze(v.x), "freeze(%d)", v.x)
+	}
+
+	// The domain is small enough to check exhaustively.
+	for x := 0; x <= 0xffff; x++ {
+		r := barrettReduce(uint16(x))
+		require.True(r <= 11768, "barrettReduce(%d): %d out of range", x, r)
+		require.Equal(uint16(x%kyberQ), freeze(uint16(x)), "freeze(%d)", x)
+	}
+}
+
+// lazyReductionAuditor mirrors nttRef and invnttRef with wide intermediate
+// values, recording the largest value that the uint16 (and uint32)
+// arithmetic in the real implementation would need to represent.
+type lazyReductionAuditor struct {
+	max16, max32 int64
+	negative     bool
+}
+
+func (a *lazyReductionAuditor) u16(v int64) uint16 {
+	if v < 0 {
+		a.negative = true
+	}
+	if v > a.max16 {
+		a.max16 = v
+	}
+	return uint16(v)
+}
+
+func (a *lazyReductionAuditor) montgomeryReduce(v int64) uint16 {
+	if v < 0 {
+		a.negative = true
+	}
+	u := (v * qinv) & ((1 << rlog) - 1)
+	if s := v + u*kyberQ; s > a.max32 {
+		a.max32 = s
+	}
+	return montgomeryReduce(uint32(v))
+}
+
+func (a *lazyReductionAuditor) ntt(p *[kyberN]uint16) {
+	var j int
+	k := 1
+	for level := 7; level >= 0; level-- {
+		distance := 1 << uint(level)
+		for start := 0; start < kyberN; start = j + distance {
+			zeta := int64(zetas[k])
+			k++
+			for j = start; j < start+distance; j++ {
+				t := int64(a.montgomeryReduce(zeta * int64(p[j+distance])))
+				p[j+distance] = barrettReduce(a.u16(int64(p[j]) + 4*kyberQ - t))
+
+				if level&1 == 1 {
+					p[j] = a.u16(int64(p[j]) + t)
+				} else {
+					p[j] = barrettReduce(a.u16(int64(p[j]) + t))
+				}
+			}
+		}
+	}
+}
+
+func (a *lazyReductionAuditor) invntt(p *[kyberN]uint16) {
+	for level := 0; level < 8; level++ {
+		distance := 1 << uint(level)
+		for start := 0; start < distance; start++ {
+			var jTwiddle int
+			for j := start; j < kyberN-1; j += 2 * distance {
+				w := int64(omegasInvBitrevMontgomery[jTwiddle])
+				jTwiddle++
+
+				temp := int64(p[j])
+
+				if level&1 == 1 {
+					p[j] = barrettReduce(a.u16(temp + int64(p[j+distance])))
+				} else {
+					p[j] = a.u16(temp + int64(p[j+distance]))
+				}
+
+				p[j+distance] = a.montgomeryReduce(w * (temp + 4*kyberQ - int64(p[j+distance])))
+			}
+		}
+	}
+
+	for i, v := range psisInvMontgomery {
+		p[i] = a.montgomeryReduce(int64(p[i]) * int64(v))
+	}
+}
+
+func TestLazyReductionOverflow(t *testing.T) {
+	require := require.New(t)
+
+	var random [kyberN]uint16
+	for i := range random {
+		random[i] = uint16((i*7919 + 13) % kyberQ)
+	}
+
+	// The inputs are fully reduced (as produced by the samplers and the
+	// deserialization routines), with the worst cases being all q-1, and
+	// alternating extremes.
+	patterns := map[string]func(int) uint16{
+		"Zero":        func(int) uint16 { return 0 },
+		"Max":         func(int) uint16 { return kyberQ - 1 },
+		"Alternating": func(i int) uint16 { return uint16((i & 1) * (kyberQ - 1)) },
+		"Random":      func(i int) uint16 { return random[i] },
+	}
+
+	for n, fn := range patterns {
+		for _, inv := range []bool{false, true} {
+			var p, expected [kyberN]uint16
+			for i := range p {
+				p[i] = fn(i)
+			}
+			expected = p
+
+			var a lazyReductionAuditor
+			if inv {
+				invnttRef(&expected)
+				a.invntt(&p)
+			} else {
+				nttRef(&expected)
+				a.ntt(&p)
+			}
+			require.Equal(expected, p, "%s (inverse: %v): Auditor mismatch", n, inv)
+			require.False(a.negative, "%s (inverse: %v): Negative intermediate", n, inv)
+			require.True(a.max16 <= 0xffff, "%s (inverse: %v): uint16 overflow: %d", n, inv, a.max16)
+			require.True(a.max32 <= 0xffffffff, "%s (inverse: %v): uint32 overflow: %d", n, inv, a.max32)
+			t.Logf("%s (inverse: %v): max uint16 intermediate: %d", n, inv, a.max16)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// stream.go - Kyber streaming public key encryption.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	// StreamChunkSize is the maximum size of the plaintext of each chunk
+	// of a stream created by NewSealWriter, in bytes.
+	StreamChunkSize = 64 * 1024
+
+	streamFrameSize = StreamChunkSize + aeadTagSize
+)
+
+var (
+	// ErrStreamAuthentication is the error returned when a stream created
+	// by NewSealWriter fails to authenticate, has been truncated, or was
+	// encrypted to a different key.
+	ErrStreamAuthentication = errors.New("kyber: stream authentication failed")
+
+	// ErrStreamClosed is the error returned when writing to a closed stream.
+	ErrStreamClosed = errors.New("kyber: stream closed")
+
+	streamKeyDomainSep = []byte("Kyber-StreamKey")
+)
+
+// The stream format is the KEM cipher text, followed by a sequence of
+// ChaCha20-Poly1305 frames, keyed with SHAKE-256("Kyber-StreamKey" || ss).
+//
+// Every frame except the last contains exactly StreamChunkSize bytes of
+// plaintext, and the last contains [0, StreamChunkSize] bytes.  The 96 bit
+// nonce of each frame is the big endian chunk index in the first 11 bytes,
+// and a final byte that is 1 for the last frame and 0 otherwise, so that
+// reordering and truncation are detected.
+
+type streamNonce [chacha20poly1305.NonceSize]byte
+
+func (n *streamNonce) set(idx uint64, isFinal bool) {
+	binary.BigEndian.PutUint64(n[3:11], idx)
+	n[11] = 0
+	if isFinal {
+		n[11] = 1
+	}
+}
+
+// newAEAD returns a ChaCha20-Poly1305 instance keyed with
+// SHAKE-256(domainSep || sharedSecret).
+func newAEAD(domainSep, sharedSecret []byte) cipher.AEAD {
+	var b, key []byte
+	b = append(b, domainSep...)
+	b = append(b, sharedSecret...)
+
+	key = make([]byte, chacha20poly1305.KeySize)
+	shakeSum256(key, b)
+	defer zeroize(key)
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		panic("kyber: failed to initialize AEAD: " + err.Error())
+	}
+
+	return aead
+}
+
+type sealWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce streamNonce
+	idx   uint64
+
+	buf    []byte
+	closed bool
+}
+
+func (s *sealWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, ErrStreamClosed
+	}
+
+	var n int
+	for len(p) > 0 {
+		// Only emit a chunk once it is known not to be the last one.
+		if len(s.buf) == StreamChunkSize {
+			if err := s.writeFrame(false); err != nil {
+				return n, err
+			}
+		}
+
+		toCopy := StreamChunkSize - len(s.buf)
+		if toCopy > len(p) {
+			toCopy = len(p)
+		}
+		s.buf = append(s.buf, p[:toCopy]...)
+		p = p[toCopy:]
+		n += toCopy
+	}
+
+	return n, nil
+}
+
+// Close writes the final frame.  It does not close the underlying
+// io.Writer.
+func (s *sealWriter) Close() error {
+	if s.closed {
+		return ErrStreamClosed
+	}
+	s.closed = true
+
+	return s.writeFrame(true)
+}
+
+func (s *sealWriter) writeFrame(isFinal bool) error {
+	s.nonce.set(s.idx, isFinal)
+	s.idx++
+
+	frame := s.aead.Seal(s.buf[:0], s.nonce[:], s.buf, nil)
+	s.buf = frame[:0]
+
+	_, err := s.w.Write(frame)
+	return err
+}
+
+// NewSealWriter creates a new io.WriteCloser that encrypts to the public key
+// pk, and writes the stream to w.  The KEM cipher text is written to w
+// immediately, and the final frame is written on Close, which MUST be
+// called.
+func NewSealWriter(pk *PublicKey, w io.Writer, rng io.Reader) (io.WriteCloser, error) {
+	cipherText, sharedSecret, err := pk.KEMEncrypt(rng)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroize(sharedSecret)
+
+	if _, err = w.Write(cipherText); err != nil {
+		return nil, err
+	}
+
+	s := &sealWriter{
+		w:    w,
+		aead: newAEAD(streamKeyDomainSep, sharedSecret),
+		buf:  make([]byte, 0, streamFrameSize),
+	}
+
+	return s, nil
+}
+
+type openReader struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	nonce streamNonce
+	idx   uint64
+
+	frame []byte
+	buf   []byte
+	err   error
+}
+
+func (o *openReader) Read(p []byte) (int, error) {
+	for len(o.buf) == 0 {
+		if o.err != nil {
+			return 0, o.err
+		}
+		o.err = o.readFrame()
+	}
+
+	n := copy(p, o.buf)
+	o.buf = o.buf[n:]
+
+	return n, nil
+}
+
+func (o *openReader) readFrame() error {
+	n, err := io.ReadFull(o.r, o.frame[:streamFrameSize])
+	var isFinal bool
+	switch err {
+	case nil:
+		// A full frame is the last one iff there is no more data.
+		if _, err = o.r.Peek(1); err == io.EOF {
+			isFinal = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF, io.EOF:
+		isFinal = true
+	default:
+		return err
+	}
+
+	o.nonce.set(o.idx, isFinal)
+	o.idx++
+
+	if o.buf, err = o.aead.Open(o.frame[:0], o.nonce[:], o.frame[:n], nil); err != nil {
+		return ErrStreamAuthentication
+	}
+	if isFinal {
+		return io.EOF
+	}
+
+	return nil
+}
+
+// NewOpenReader creates a new io.Reader that decrypts a stream created by
+// NewSealWriter from r, with the private key sk.  Plaintext is only returned
+// after the frame containing it has been authenticated, however callers MUST
+// NOT consider the plaintext complete until io.EOF is returned, as any
+// authentication failure (including truncation) results in
+// ErrStreamAuthentication.
+func NewOpenReader(sk *PrivateKey, r io.Reader) (io.Reader, error) {
+	cipherText := make([]byte, sk.PublicKey.p.CipherTextSize())
+	if _, err := io.ReadFull(r, cipherText); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	sharedSecret := sk.KEMDecrypt(cipherText)
+	defer zeroize(sharedSecret)
+
+	o := &openReader{
+		r:     bufio.NewReader(r),
+		aead:  newAEAD(streamKeyDomainSep, sharedSecret),
+		frame: make([]byte, streamFrameSize),
+	}
+
+	return o, nil
+}
@@ -0,0 +1,92 @@
+// stream_test.go - Kyber streaming public key encryption tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	require := require.New(t)
+
+	p := Kyber768
+	pk, sk, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+
+	for _, sz := range []int{0, 1, StreamChunkSize - 1, StreamChunkSize, StreamChunkSize + 1, 3*StreamChunkSize + 17} {
+		msg := make([]byte, sz)
+		_, err = rand.Read(msg)
+		require.NoError(err, "rand.Read()")
+
+		var ct bytes.Buffer
+		w, err := NewSealWriter(pk, &ct, rand.Reader)
+		require.NoError(err, "NewSealWriter(): %d", sz)
+		for off := 0; off < sz; off += 4093 { // Exercise unaligned writes.
+			end := off + 4093
+			if end > sz {
+				end = sz
+			}
+			_, err = w.Write(msg[off:end])
+			require.NoError(err, "Write(): %d", sz)
+		}
+		require.NoError(w.Close(), "Close(): %d", sz)
+		_, err = w.Write([]byte{0})
+		require.Equal(ErrStreamClosed, err, "Write(): Closed")
+
+		frames := (sz + StreamChunkSize - 1) / StreamChunkSize
+		if frames == 0 {
+			frames = 1
+		}
+		require.Equal(p.CipherTextSize()+sz+frames*aeadTagSize, ct.Len(), "Stream length: %d", sz)
+
+		r, err := NewOpenReader(sk, bytes.NewReader(ct.Bytes()))
+		require.NoError(err, "NewOpenReader(): %d", sz)
+		pt, err := ioutil.ReadAll(r)
+		require.NoError(err, "ReadAll(): %d", sz)
+		require.Equal(msg, pt, "ReadAll(): %d", sz)
+
+		// Truncation (including at a frame boundary) must be detected.
+		for _, l := range []int{ct.Len() - 1, p.CipherTextSize() + streamFrameSize} {
+			if l >= ct.Len() {
+				continue
+			}
+			r, err = NewOpenReader(sk, bytes.NewReader(ct.Bytes()[:l]))
+			require.NoError(err, "NewOpenReader(): Truncated %d", sz)
+			_, err = ioutil.ReadAll(r)
+			require.Equal(ErrStreamAuthentication, err, "ReadAll(): Truncated %d", sz)
+		}
+
+		// Corruption must be detected.
+		b := append([]byte{}, ct.Bytes()...)
+		b[len(b)-1] ^= 0x01
+		r, err = NewOpenReader(sk, bytes.NewReader(b))
+		require.NoError(err, "NewOpenReader(): Corrupted %d", sz)
+		_, err = ioutil.ReadAll(r)
+		require.Equal(ErrStreamAuthentication, err, "ReadAll(): Corrupted %d", sz)
+	}
+
+	// Decrypting with the wrong key must fail.
+	_, sk2, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+	var ct bytes.Buffer
+	w, err := NewSealWriter(pk, &ct, rand.Reader)
+	require.NoError(err, "NewSealWriter()")
+	require.NoError(w.Close(), "Close()")
+	r, err := NewOpenReader(sk2, &ct)
+	require.NoError(err, "NewOpenReader(): Wrong key")
+	_, err = ioutil.ReadAll(r)
+	require.Equal(ErrStreamAuthentication, err, "ReadAll(): Wrong key")
+
+	_, err = NewOpenReader(sk, bytes.NewReader(nil))
+	require.Error(err, "NewOpenReader(): Empty")
+}
@@ -0,0 +1,120 @@
+// timing_test.go - Kyber constant time tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// +build timing
+
+package kyber
+
+import (
+	"crypto/rand"
+	"flag"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	timingSamples   = flag.Int("timing-samples", 1<<15, "number of measurements per class for the timing tests")
+	timingThreshold = flag.Float64("timing-threshold", 10, "maximum absolute Welch's t statistic for the timing tests")
+)
+
+const timingBatchSize = 256
+
+// timingHarness is a minimal dudect style timing leak detector, that
+// compares the execution time distributions of two classes of inputs with
+// Welch's t-test, after cropping the slowest measurements (which are
+// dominated by interrupts and scheduling).
+type timingHarness struct {
+	samples [2][]float64
+}
+
+func (h *timingHarness) measure(class int, fn func()) {
+	start := time.Now()
+	fn()
+	h.samples[class] = append(h.samples[class], float64(time.Since(start)))
+}
+
+func (h *timingHarness) tStatistic() float64 {
+	var mean, variance [2]float64
+	for class, s := range h.samples {
+		s = cropSamples(s, 0.9)
+
+		for _, v := range s {
+			mean[class] += v
+		}
+		mean[class] /= float64(len(s))
+		for _, v := range s {
+			d := v - mean[class]
+			variance[class] += d * d
+		}
+		variance[class] /= float64(len(s) - 1)
+		variance[class] /= float64(len(s)) // Variance of the mean.
+	}
+
+	return (mean[0] - mean[1]) / math.Sqrt(variance[0]+variance[1])
+}
+
+func cropSamples(s []float64, percentile float64) []float64 {
+	s = append([]float64{}, s...)
+	sort.Float64s(s)
+	return s[:int(float64(len(s))*percentile)]
+}
+
+// TestUAKESharedTiming checks that UAKEInitiatorState.Shared takes the same
+// amount of time whether the responder's cipher text decapsulates
+// successfully, or is implicitly rejected.  This is slow and inherently
+// noisy, so it is only built with `-tags timing`, eg:
+//
+//   go test -tags timing -run Timing -timeout 0
+//
+// Classes are interleaved randomly, and all of the inputs are generated
+// outside of the measurements.
+func TestUAKESharedTiming(t *testing.T) {
+	for _, p := range allParams {
+		t.Run(p.Name(), func(t *testing.T) { doTestUAKESharedTiming(t, p) })
+	}
+}
+
+func doTestUAKESharedTiming(t *testing.T, p *ParameterSet) {
+	require := require.New(t)
+
+	pkB, skB, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+
+	var (
+		h       timingHarness
+		classes [timingBatchSize]byte
+		states  [timingBatchSize]*UAKEInitiatorState
+		msgs    [timingBatchSize][]byte
+	)
+	for n := 0; n < 2*(*timingSamples); n += timingBatchSize {
+		_, err = rand.Read(classes[:])
+		require.NoError(err, "rand.Read()")
+
+		for i := range states {
+			states[i], err = pkB.NewUAKEInitiatorState(rand.Reader)
+			require.NoError(err, "NewUAKEInitiatorState()")
+			msgs[i], _ = p.UAKEResponderShared(rand.Reader, states[i].Message, skB)
+			if classes[i]&1 == 1 {
+				// Force an implicit rejection.
+				msgs[i][int(classes[i])%len(msgs[i])] ^= 0x01
+			}
+		}
+
+		for i, s := range states {
+			msg := msgs[i]
+			h.measure(int(classes[i]&1), func() { s.Shared(msg) })
+		}
+	}
+
+	tStat := h.tStatistic()
+	t.Logf("t = %g (%d/%d samples)", tStat, len(h.samples[0]), len(h.samples[1]))
+	require.True(math.Abs(tStat) < *timingThreshold, "Shared(): Timing depends on decapsulation success (t = %g)", tStat)
+}
@@ -0,0 +1,34 @@
+// trace.go - Intermediate state tracing for verification.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+// Intermediate state tracing is a verification-only facility, that exposes
+// the (secret) intermediate polynomial vectors of key generation and
+// encryption, for cross-checking other implementations against this one.
+// It is only available when built with `-tags kybertrace`, and otherwise
+// traceEnabled is false, so that the tracing calls are eliminated entirely.
+
+func tracePolyVec(label string, v *polyVec) {
+	if traceSink == nil {
+		return
+	}
+
+	b := make([]byte, len(v.vec)*polySize)
+	v.toBytes(b)
+	traceSink(label, b)
+}
+
+func tracePoly(label string, p *poly) {
+	if traceSink == nil {
+		return
+	}
+
+	b := make([]byte, polySize)
+	p.toBytes(b)
+	traceSink(label, b)
+}
@@ -0,0 +1,39 @@
+// trace_enabled.go - Intermediate state tracing (enabled).
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// +build kybertrace
+
+package kyber
+
+const traceEnabled = true
+
+var traceSink func(label string, data []byte)
+
+// SetTraceSink sets the function that is called with the label and the
+// serialized (13 bits per coefficient, as per Bytes) value of each
+// intermediate polynomial (vector) of key generation and encryption, or nil
+// to disable tracing.  The labels are:
+//
+//	"keypair/skpv"  - The secret key, after the NTT.
+//	"keypair/e"     - The error vector.
+//	"keypair/pkpv"  - The public key, before packing.
+//	"encrypt/sp"    - The ephemeral secret, after the NTT.
+//	"encrypt/ep"    - The error vector.
+//	"encrypt/bp"    - The cipher text vector, before compression.
+//	"encrypt/v"     - The cipher text polynomial, before compression.
+//
+// Note that decapsulation re-encrypts, and thus also emits the "encrypt/"
+// values.
+//
+// WARNING: This is ONLY intended for verifying other implementations
+// against this one.  The traced values include secret keys and the
+// encryption randomness, and COMPLETELY BREAK the security of everything.
+// This is only available when built with `-tags kybertrace`, and is not
+// safe to call concurrently with any other operation.
+func SetTraceSink(sink func(label string, data []byte)) {
+	traceSink = sink
+}
@@ -0,0 +1,56 @@
+// trace_test.go - Intermediate state tracing tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+// +build kybertrace
+
+package kyber
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceSink(t *testing.T) {
+	require := require.New(t)
+
+	p := Kyber768
+	traced := make(map[string][]byte)
+	SetTraceSink(func(label string, data []byte) {
+		traced[label] = data
+	})
+	defer SetTraceSink(nil)
+
+	pk, sk, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+	require.Equal(sk.sk.packed, traced["keypair/skpv"], "keypair/skpv")
+	require.Len(traced["keypair/e"], p.polyVecSize, "keypair/e")
+	require.Len(traced["keypair/pkpv"], p.polyVecSize, "keypair/pkpv")
+
+	ct, _, err := pk.KEMEncrypt(rand.Reader)
+	require.NoError(err, "KEMEncrypt()")
+	for _, label := range []string{"encrypt/sp", "encrypt/ep", "encrypt/bp"} {
+		require.Len(traced[label], p.polyVecSize, label)
+	}
+	require.Len(traced["encrypt/v"], polySize, "encrypt/v")
+
+	// The traced cipher text must compress to the actual cipher text.
+	var v poly
+	bp := p.allocPolyVec()
+	bp.fromBytes(traced["encrypt/bp"])
+	v.fromBytes(traced["encrypt/v"])
+	ct2 := make([]byte, p.CipherTextSize())
+	packCiphertext(ct2, &bp, &v)
+	require.Equal(ct, ct2, "encrypt/bp, encrypt/v")
+
+	SetTraceSink(nil)
+	traced = make(map[string][]byte)
+	_, _, err = p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair(): Disabled")
+	require.Empty(traced, "SetTraceSink(nil)")
+}
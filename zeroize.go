@@ -0,0 +1,21 @@
+// zeroize.go - Sensitive buffer scrubbing.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import "runtime"
+
+// zeroize overwrites b with zeros.  The runtime.KeepAlive call ensures that
+// the stores are not elided as dead, even if b is never read again.
+//
+//go:noinline
+func zeroize(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+	runtime.KeepAlive(b)
+}
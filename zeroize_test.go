@@ -0,0 +1,63 @@
+// zeroize_test.go - Sensitive buffer scrubbing tests.
+//
+// To the extent possible under law, Yawning Angel has waived all copyright
+// and related or neighboring rights to the software, using the Creative
+// Commons "CC0" public domain dedication. See LICENSE or
+// <http://creativecommons.org/publicdomain/zero/1.0/> for full details.
+
+package kyber
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestZeroize(t *testing.T) {
+	require := require.New(t)
+
+	var zero SharedSecret
+
+	ss := new(SharedSecret)
+	_, err := rand.Read(ss[:])
+	require.NoError(err, "rand.Read()")
+	require.NotEqual(&zero, ss, "SharedSecret: Initial")
+
+	ss.Zeroize()
+	require.Equal(&zero, ss, "SharedSecret.Zeroize()")
+}
+
+func TestZeroizeKeyExchange(t *testing.T) {
+	require := require.New(t)
+
+	p := Kyber768
+	pk, sk, err := p.GenerateKeyPair(rand.Reader)
+	require.NoError(err, "GenerateKeyPair()")
+
+	sk.Zeroize()
+	require.True(isAllZero(sk.sk.packed), "PrivateKey.Zeroize(): sk")
+	require.True(isAllZero(sk.z), "PrivateKey.Zeroize(): z")
+
+	kex, err := p.NewKEXInitiatorState(rand.Reader)
+	require.NoError(err, "NewKEXInitiatorState()")
+	kex.Zeroize()
+	require.True(isAllZero(kex.eSk.z), "KEXInitiatorState.Zeroize(): eSk")
+	require.True(isAllZero(kex.Message), "KEXInitiatorState.Zeroize(): Message")
+	require.Panics(func() { kex.Shared(make([]byte, p.CipherTextSize())) }, "KEXInitiatorState.Zeroize(): Shared")
+
+	uake, err := pk.NewUAKEInitiatorState(rand.Reader)
+	require.NoError(err, "NewUAKEInitiatorState()")
+	uake.Zeroize()
+	require.True(isAllZero(uake.eSk.sk.packed), "UAKEInitiatorState.Zeroize(): eSk")
+	require.True(isAllZero(uake.tk), "UAKEInitiatorState.Zeroize(): tk")
+	require.True(isAllZero(uake.Message), "UAKEInitiatorState.Zeroize(): Message")
+	require.Panics(func() { uake.Shared(make([]byte, p.CipherTextSize())) }, "UAKEInitiatorState.Zeroize(): Shared")
+
+	ake, err := pk.NewAKEInitiatorState(rand.Reader)
+	require.NoError(err, "NewAKEInitiatorState()")
+	ake.Zeroize()
+	require.True(isAllZero(ake.eSk.sk.packed), "AKEInitiatorState.Zeroize(): eSk")
+	require.True(isAllZero(ake.tk), "AKEInitiatorState.Zeroize(): tk")
+	require.True(isAllZero(ake.Message), "AKEInitiatorState.Zeroize(): Message")
+}